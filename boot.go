@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// formatPorts formats port bindings in the same format as `docker run
+// --publish`, so that they can be edited by the user.
+func formatPorts(ports []snapshot.PortBinding) string {
+	var specs []string
+	for _, port := range ports {
+		spec := port.HostPort + ":" + port.ContainerPort
+		if port.HostIP != "" {
+			spec = port.HostIP + ":" + spec
+		}
+		specs = append(specs, spec)
+	}
+	return strings.Join(specs, ", ")
+}
+
+// parsePorts parses comma separated port bindings in the format
+// [[HOST_IP:]HOST_PORT:]CONTAINER_PORT[/PROTOCOL]. If the host port is
+// omitted, Docker picks a random port.
+func parsePorts(specs string) ([]snapshot.PortBinding, error) {
+	ports := []snapshot.PortBinding{}
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		var port snapshot.PortBinding
+		parts := strings.Split(spec, ":")
+		switch len(parts) {
+		case 1:
+			port.ContainerPort = parts[0]
+		case 2:
+			port.HostPort, port.ContainerPort = parts[0], parts[1]
+		case 3:
+			port.HostIP, port.HostPort, port.ContainerPort = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("malformed port %q", spec)
+		}
+
+		if port.ContainerPort == "" {
+			return nil, fmt.Errorf("malformed port %q: missing container port", spec)
+		}
+		if !strings.Contains(port.ContainerPort, "/") {
+			port.ContainerPort += "/tcp"
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
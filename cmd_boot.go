@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newBootCommand() *cobra.Command {
+	var name string
+	var publish []string
+	cmd := &cobra.Command{
+		Use:   "boot SNAPSHOT",
+		Short: "Boot a new container from a snapshot",
+		Long: "Boot a new container from a snapshot. The container is configured with the " +
+			"environment, command, ports, networks, and restart policy of the container " +
+			"that the snapshot was created from.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			manager := snapshot.NewManager(dockerClient)
+			snap, err := manager.Find(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			opts := snapshot.BootOptions{Name: name}
+			if cmd.Flags().Changed("publish") {
+				opts.Ports, err = parsePorts(strings.Join(publish, ","))
+				if err != nil {
+					return err
+				}
+			}
+
+			result, err := manager.Boot(ctx, snap, opts, os.Stderr)
+			if err != nil {
+				return err
+			}
+			for _, notice := range result.Notices {
+				fmt.Fprintln(os.Stderr, notice)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&name, "name", "", "the name of the new container")
+	cmd.Flags().StringSliceVarP(&publish, "publish", "p", nil,
+		"publish these ports instead of the snapshot's ports, in the format "+
+			"[[HOST_IP:]HOST_PORT:]CONTAINER_PORT[/PROTOCOL]. Pass an empty value to publish no ports")
+	return cmd
+}
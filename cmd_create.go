@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newCreateCommand() *cobra.Command {
+	var title, imageName, project, volume, dbUser, consistency string
+	var mounts, exclude []string
+	var dumpStopped bool
+	cmd := &cobra.Command{
+		Use:   "create [CONTAINER...]",
+		Short: "Snapshot one or more containers, or a volume",
+		Long: "Snapshot one or more containers, or a volume. When multiple containers, or a " +
+			"docker-compose project, are given, the containers are snapshotted together as a " +
+			"group so that their data is consistent with each other.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if title == "" {
+				return errors.New("a title is required")
+			}
+			if len(args) == 0 && project == "" && volume == "" {
+				return errors.New("either containers, a docker-compose project, or a volume must be specified")
+			}
+			if volume != "" && (len(args) != 0 || project != "") {
+				return errors.New("volumes must be snapshotted on their own")
+			}
+			if cmd.Flags().Changed("mount") && (len(args) != 1 || project != "") {
+				return errors.New("mounts can only be chosen when snapshotting a single container")
+			}
+			if imageName == "" {
+				imageName = snapshot.ImageNameForTitle(title)
+			}
+
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			consistencyMode, err := snapshot.ParseConsistency(consistency)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			// The patterns from the config file are always excluded, in
+			// addition to the patterns passed on the command line.
+			opts := snapshot.CreateOptions{
+				Title:       title,
+				ImageName:   imageName,
+				Consistency: consistencyMode,
+				Exclude:     append(cfg.Exclude, exclude...),
+			}
+			if err := snapshot.ValidateExcludePatterns(opts.Exclude); err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			if volume != "" {
+				return snapshot.NewVolume(dockerClient).Create(ctx, volume, opts)
+			}
+
+			var containers []Container
+			if project != "" {
+				containers, err = listProjectContainers(ctx, dockerClient, project)
+				if err != nil {
+					return fmt.Errorf("list project containers: %w", err)
+				}
+				if len(containers) == 0 {
+					return fmt.Errorf("no containers in docker-compose project %q", project)
+				}
+			}
+
+			if len(args) > 0 {
+				all, err := listContainers(ctx, dockerClient)
+				if err != nil {
+					return fmt.Errorf("list containers: %w", err)
+				}
+				for _, ref := range args {
+					container, err := findContainer(all, ref)
+					if err != nil {
+						return err
+					}
+					containers = append(containers, container)
+				}
+			}
+
+			if project == "" && len(containers) == 1 {
+				container := containers[0]
+				if cmd.Flags().Changed("mount") {
+					if err := checkMounts(container, mounts); err != nil {
+						return err
+					}
+					opts.Mounts = mounts
+				}
+				target := hookTarget{
+					container: container,
+					hooks:     containerHooks(cfg.Hooks, container),
+					imageName: opts.ImageName,
+				}
+				return withHooks(ctx, dockerClient, []hookTarget{target}, opts.Title, os.Stderr, func() error {
+					return snapshotContainer(ctx, dockerClient, container, opts, dbUser, dumpStopped,
+						func(err error) {
+							fmt.Fprintf(os.Stderr, "Failed to create database aware snapshot, "+
+								"falling back to a generic snapshot: %s\n", err)
+						})
+				})
+			}
+			return snapshotGroup(ctx, dockerClient, containers, opts, cfg.Hooks, os.Stderr)
+		},
+	}
+	cmd.Flags().StringVar(&title, "title", "", "the title of the snapshot")
+	cmd.Flags().StringVar(&imageName, "image", "", "the image name of the snapshot. "+
+		"Defaults to a name derived from the title")
+	cmd.Flags().StringVar(&project, "project", "", "snapshot all the containers in the docker-compose project")
+	cmd.Flags().StringVar(&volume, "volume", "", "snapshot the named volume instead of a container")
+	cmd.Flags().StringVar(&dbUser, "db-user", "", "the database user for Postgres snapshots")
+	cmd.Flags().StringSliceVar(&mounts, "mount", nil,
+		"the destinations of the mounts to capture in generic snapshots, including bind and tmpfs mounts. "+
+			"By default, only volumes are captured")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil,
+		"glob patterns for files in volumes that generic snapshots don't capture, such as node_modules or *.log")
+	cmd.Flags().BoolVar(&dumpStopped, "dump-stopped", false,
+		"dump the databases of stopped containers by booting a temporary copy of them, "+
+			"rather than taking a generic snapshot")
+	cmd.Flags().StringVar(&consistency, "consistency", string(snapshot.ConsistencyLive),
+		"how to keep generic snapshots consistent: live, pause, or stop. "+
+			"Pausing and stopping freeze the container while it's captured")
+	return cmd
+}
+
+// findContainer returns the container with the given name or ID prefix.
+func findContainer(containers []Container, ref string) (Container, error) {
+	for _, container := range containers {
+		if containerName(container) == ref {
+			return container, nil
+		}
+	}
+
+	var matches []Container
+	for _, container := range containers {
+		if ref != "" && strings.HasPrefix(container.ID, ref) {
+			matches = append(matches, container)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Container{}, fmt.Errorf("no container named %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return Container{}, fmt.Errorf("container ID prefix %q is ambiguous", ref)
+	}
+}
+
+// checkMounts returns an error if any of the destinations aren't mounted in
+// the container.
+func checkMounts(container Container, destinations []string) error {
+	mounted := map[string]bool{}
+	for _, mount := range snapshot.ContainerMounts(container.ContainerJSON) {
+		mounted[mount.Destination] = true
+	}
+	for _, destination := range destinations {
+		if !mounted[destination] {
+			return fmt.Errorf("nothing is mounted at %s in the container", destination)
+		}
+	}
+	return nil
+}
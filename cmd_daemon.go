@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// defaultTitleTemplate is the title of scheduled snapshots when the schedule
+// doesn't set one.
+const defaultTitleTemplate = `{{.Source}} {{.Time.Format "2006-01-02 15:04"}}`
+
+// defaultRuleTitleTemplate is the title of snapshots triggered by rules when
+// the rule doesn't set one. Events can happen in quick succession, so it
+// includes seconds to avoid reusing image names.
+const defaultRuleTitleTemplate = `{{.Source}} {{.Trigger}} {{.Time.Format "2006-01-02 15:04:05"}}`
+
+func newDaemonCommand() *cobra.Command {
+	var sc scheduleConfig
+	var keepLast int
+	var maxAge string
+	cmd := &cobra.Command{
+		Use:   "daemon [CONTAINER...]",
+		Short: "Automatically snapshot containers on a schedule, or when events happen",
+		Long: "Automatically snapshot containers on a schedule, or when events happen. The " +
+			"schedules and rules are read from the config file. An extra schedule can be given " +
+			"with flags, in which case the given containers or project are snapshotted. " +
+			"Containers can also declare rules with the " + snapshotOnLabel + " label. Old " +
+			"snapshots created by each schedule or rule are pruned according to its retention policy.\n\n" +
+			"Rules can't snapshot containers before they're stopped or removed. Stop rules snapshot " +
+			"containers after they exit, and removed containers, including containers started with " +
+			"--rm, can't be snapshotted at all.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			scheduleConfigs := cfg.Schedules
+			if len(args) > 0 || sc.Project != "" {
+				sc.Containers = args
+				sc.Retention = retentionConfig{KeepLast: keepLast, MaxAge: maxAge}
+				scheduleConfigs = append(scheduleConfigs, sc)
+			}
+
+			names := map[string]bool{labelRuleName: true}
+			checkName := func(name string) error {
+				if names[name] {
+					return fmt.Errorf("duplicate schedule or rule name %q", name)
+				}
+				names[name] = true
+				return nil
+			}
+
+			var schedules []*daemonSchedule
+			for _, config := range scheduleConfigs {
+				s, err := newDaemonSchedule(config)
+				if err != nil {
+					return err
+				}
+				if err := checkName(s.name); err != nil {
+					return err
+				}
+				schedules = append(schedules, s)
+			}
+
+			var rules []*daemonRule
+			for _, config := range cfg.Rules {
+				r, err := newDaemonRule(config)
+				if err != nil {
+					return err
+				}
+				if err := checkName(r.name); err != nil {
+					return err
+				}
+				rules = append(rules, r)
+			}
+
+			if len(schedules) == 0 && len(rules) == 0 {
+				log.Printf("No schedules or rules are configured. Only containers with the %s label "+
+					"will be snapshotted", snapshotOnLabel)
+			}
+
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-signals
+				cancel()
+			}()
+
+			d := &daemon{client: dockerClient, exclude: cfg.Exclude, hooks: cfg.Hooks}
+			d.run(ctx, schedules, rules)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&sc.Name, "name", "default", "the name of the schedule given by flags")
+	cmd.Flags().StringVar(&sc.Project, "project", "", "snapshot all the containers in the docker-compose project")
+	cmd.Flags().StringVar(&sc.Every, "every", "", `the interval between snapshots, such as "1h"`)
+	cmd.Flags().StringVar(&sc.Cron, "cron", "", `a cron expression for when to take snapshots, such as "0 * * * *"`)
+	cmd.Flags().StringVar(&sc.Title, "title", defaultTitleTemplate,
+		"a template for the snapshot titles. {{.Source}}, {{.Schedule}}, and {{.Time}} are available")
+	cmd.Flags().StringVar(&sc.Consistency, "consistency", string(snapshot.ConsistencyLive),
+		"how to keep generic snapshots consistent: live, pause, or stop")
+	cmd.Flags().IntVar(&keepLast, "keep-last", 0,
+		"the number of snapshots to keep for each container")
+	cmd.Flags().StringVar(&maxAge, "max-age", "",
+		`remove the schedule's snapshots older than this age, such as "72h" or "30d"`)
+	return cmd
+}
+
+// automation contains the parsed settings shared by schedules and rules.
+type automation struct {
+	// kind is either "schedule" or "rule", and is used in messages.
+	kind        string
+	name        string
+	title       *template.Template
+	consistency snapshot.Consistency
+	retention   snapshot.RetentionPolicy
+}
+
+func newAutomation(kind string, config automationConfig, defaultTitle string) (*automation, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("%ss must have a name", kind)
+	}
+
+	a := &automation{kind: kind, name: config.Name}
+	titleTemplate := config.Title
+	if titleTemplate == "" {
+		titleTemplate = defaultTitle
+	}
+
+	var err error
+	a.title, err = template.New("title").Parse(titleTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: parse title: %w", kind, config.Name, err)
+	}
+
+	a.consistency = snapshot.ConsistencyLive
+	if config.Consistency != "" {
+		a.consistency, err = snapshot.ParseConsistency(config.Consistency)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", kind, config.Name, err)
+		}
+	}
+
+	a.retention, err = config.Retention.policy()
+	if err != nil {
+		return nil, fmt.Errorf("%s %q: %w", kind, config.Name, err)
+	}
+	return a, nil
+}
+
+// titleData is the data available to title templates.
+type titleData struct {
+	// Source is the name of the container, or of the docker-compose
+	// project.
+	Source string
+
+	// Schedule is the name of the schedule or rule.
+	Schedule string
+
+	// Trigger is the event that triggered the snapshot, or "schedule" for
+	// scheduled snapshots.
+	Trigger string
+
+	Time time.Time
+}
+
+func (a *automation) makeTitle(source, trigger string, t time.Time) (string, error) {
+	var title bytes.Buffer
+	err := a.title.Execute(&title, titleData{Source: source, Schedule: a.name, Trigger: trigger, Time: t})
+	if err != nil {
+		return "", fmt.Errorf("render title: %w", err)
+	}
+	return title.String(), nil
+}
+
+func (a *automation) logf(format string, args ...interface{}) {
+	log.Printf("%s %q: %s", a.kind, a.name, fmt.Sprintf(format, args...))
+}
+
+// createOptions returns the options for snapshots of the given source.
+func (a *automation) createOptions(source, trigger string, t time.Time, exclude []string) (
+	snapshot.CreateOptions, error) {
+	title, err := a.makeTitle(source, trigger, t)
+	if err != nil {
+		return snapshot.CreateOptions{}, err
+	}
+
+	return snapshot.CreateOptions{
+		Title:       title,
+		ImageName:   snapshot.ImageNameForTitle(title),
+		Consistency: a.consistency,
+		Exclude:     exclude,
+		Schedule:    a.name,
+	}, nil
+}
+
+// daemonSchedule is a parsed scheduleConfig.
+type daemonSchedule struct {
+	*automation
+	containers []string
+	project    string
+	schedule   schedule
+}
+
+func newDaemonSchedule(config scheduleConfig) (*daemonSchedule, error) {
+	a, err := newAutomation("schedule", config.automationConfig, defaultTitleTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Containers) == 0 && config.Project == "" {
+		return nil, fmt.Errorf("schedule %q: either containers or a docker-compose project is required", config.Name)
+	}
+
+	s := &daemonSchedule{
+		automation: a,
+		containers: config.Containers,
+		project:    config.Project,
+	}
+	s.schedule, err = parseSchedule(config.Every, config.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("schedule %q: %w", config.Name, err)
+	}
+	return s, nil
+}
+
+// daemon takes the snapshots for a set of schedules and rules.
+type daemon struct {
+	client  *client.Client
+	exclude []string
+	hooks   []hookConfig
+
+	// lock makes sure that only one snapshot is taken at a time, so that
+	// overlapping schedules and rules don't overload Docker.
+	lock sync.Mutex
+
+	// ruleSnapshots tracks the snapshots triggered by rules that are in
+	// progress.
+	ruleSnapshots sync.WaitGroup
+}
+
+// run runs the schedules and rules until the context is cancelled.
+func (d *daemon) run(ctx context.Context, schedules []*daemonSchedule, rules []*daemonRule) {
+	var wg sync.WaitGroup
+	for _, s := range schedules {
+		wg.Add(1)
+		go func(s *daemonSchedule) {
+			defer wg.Done()
+			d.runSchedule(ctx, s)
+		}(s)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.watchRules(ctx, rules)
+	}()
+	wg.Wait()
+	d.ruleSnapshots.Wait()
+}
+
+func (d *daemon) runSchedule(ctx context.Context, s *daemonSchedule) {
+	for {
+		next := s.schedule.next(time.Now())
+		if next.IsZero() {
+			s.logf("never fires")
+			return
+		}
+		s.logf("next snapshot at %s", next.Format(time.RFC1123))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		d.lock.Lock()
+		if err := d.snapshotSchedule(ctx, s, next); err != nil {
+			s.logf("%s", err)
+		}
+		if err := d.prune(ctx, s.automation); err != nil {
+			s.logf("prune: %s", err)
+		}
+		d.lock.Unlock()
+	}
+}
+
+// snapshotSchedule takes the snapshots for a single run of the schedule.
+func (d *daemon) snapshotSchedule(ctx context.Context, s *daemonSchedule, t time.Time) error {
+	if s.project != "" {
+		members, err := listProjectContainers(ctx, d.client, s.project)
+		if err != nil {
+			return fmt.Errorf("list project containers: %w", err)
+		}
+		if len(members) == 0 {
+			return fmt.Errorf("no containers in docker-compose project %q", s.project)
+		}
+
+		opts, err := s.createOptions(s.project, "schedule", t, d.exclude)
+		if err != nil {
+			return err
+		}
+		s.logf("snapshotting project %s", s.project)
+		if err := snapshotGroup(ctx, d.client, members, opts, d.hooks, os.Stderr); err != nil {
+			return fmt.Errorf("snapshot project %s: %w", s.project, err)
+		}
+	}
+
+	if len(s.containers) == 0 {
+		return nil
+	}
+
+	containers, err := listContainers(ctx, d.client)
+	if err != nil {
+		return fmt.Errorf("list containers: %w", err)
+	}
+
+	// Keep snapshotting the other containers if one of them fails.
+	var failed int
+	for _, ref := range s.containers {
+		container, err := findContainer(containers, ref)
+		if err == nil {
+			// The data in stopped containers doesn't change, so there's no
+			// point in snapshotting them again.
+			if !isRunning(container) {
+				s.logf("skipping %s since it isn't running", ref)
+				continue
+			}
+			err = d.snapshotContainer(ctx, s.automation, container, "schedule", t)
+		}
+		if err != nil {
+			s.logf("%s", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to snapshot %d containers", failed)
+	}
+	return nil
+}
+
+// watchRules snapshots containers when the events of the rules happen.
+func (d *daemon) watchRules(ctx context.Context, rules []*daemonRule) {
+	labelAutomation, err := newAutomation("rule", automationConfig{Name: labelRuleName}, defaultRuleTitleTemplate)
+	if err != nil {
+		// The default settings are always valid.
+		panic(err)
+	}
+
+	tracker := newExecTracker()
+	for e := range watchEvents(ctx, d.client, "container", ruleEventActions...) {
+		event, ok := tracker.parse(e)
+		if !ok {
+			continue
+		}
+
+		// Take at most one snapshot per event, even if multiple rules
+		// match.
+		candidates := append([]*daemonRule{}, rules...)
+		candidates = append(candidates, labelRules(labelAutomation, event.attributes)...)
+		for _, rule := range candidates {
+			if rule.matches(event) {
+				d.ruleSnapshots.Add(1)
+				go func(rule *daemonRule, t time.Time) {
+					defer d.ruleSnapshots.Done()
+					d.runRule(ctx, rule, event, t)
+				}(rule, time.Unix(0, e.TimeNano))
+				break
+			}
+		}
+	}
+}
+
+func (d *daemon) runRule(ctx context.Context, r *daemonRule, event ruleEvent, t time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	containers, err := listContainers(ctx, d.client)
+	if err != nil {
+		r.logf("list containers: %s", err)
+		return
+	}
+
+	container, err := findContainer(containers, event.containerID)
+	if err != nil {
+		r.logf("%s was removed before it could be snapshotted. Rules can't snapshot removed containers, "+
+			"such as containers started with --rm: %s", event.attributes["name"], err)
+		return
+	}
+
+	trigger := event.trigger
+	if event.command != "" {
+		trigger += " " + r.command
+	}
+	if err := d.snapshotContainer(ctx, r.automation, container, trigger, t); err != nil {
+		r.logf("%s", err)
+	}
+	if err := d.prune(ctx, r.automation); err != nil {
+		r.logf("prune: %s", err)
+	}
+}
+
+func (d *daemon) snapshotContainer(ctx context.Context, a *automation, container Container, trigger string,
+	t time.Time) error {
+	name := containerName(container)
+	opts, err := a.createOptions(name, trigger, t, d.exclude)
+	if err != nil {
+		return err
+	}
+
+	a.logf("snapshotting %s", name)
+	target := hookTarget{
+		container: container,
+		hooks:     containerHooks(d.hooks, container),
+		imageName: opts.ImageName,
+	}
+	err = withHooks(ctx, d.client, []hookTarget{target}, opts.Title, os.Stderr, func() error {
+		return snapshotContainer(ctx, d.client, container, opts, "", false,
+			func(err error) {
+				a.logf("failed to create database aware snapshot of %s, "+
+					"falling back to a generic snapshot: %s", name, err)
+			})
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot %s: %w", name, err)
+	}
+	return nil
+}
+
+// prune removes the snapshots created by the schedule or rule that break its
+// retention policy. Snapshots created by users, or by other schedules or
+// rules, aren't affected.
+func (d *daemon) prune(ctx context.Context, a *automation) error {
+	if a.retention.KeepLast == 0 && a.retention.MaxAge == 0 {
+		return nil
+	}
+
+	snapshots, err := snapshot.List(ctx, d.client)
+	if err != nil {
+		return fmt.Errorf("list snapshots: %w", err)
+	}
+
+	var automatic []*snapshot.Snapshot
+	for _, snap := range snapshots {
+		if snap.Schedule == a.name {
+			automatic = append(automatic, snap)
+		}
+	}
+
+	for _, decision := range snapshot.PlanPrune(automatic, a.retention, time.Now()) {
+		if !decision.Remove {
+			continue
+		}
+
+		snap := decision.Snapshot
+		if err := snapshot.Remove(ctx, d.client, snap, false); err != nil {
+			a.logf("failed to remove %q: %s", snap.Title, err)
+			continue
+		}
+		a.logf("removed %q (%s)", snap.Title, decision.Reason)
+	}
+	return nil
+}
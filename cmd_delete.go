@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newDeleteCommand() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "delete SNAPSHOT...",
+		Short: "Delete snapshots",
+		Long: "Delete snapshots. Snapshots created from the deleted snapshots keep " +
+			"working, since Docker keeps the images they're built on.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			// Resolve all the references before deleting anything.
+			var toDelete []*snapshot.Snapshot
+			for _, ref := range args {
+				snap, err := snapshot.Find(snapshots, ref)
+				if err != nil {
+					return err
+				}
+				toDelete = append(toDelete, snap)
+			}
+
+			for _, snap := range toDelete {
+				err := snapshot.Remove(ctx, dockerClient, snap, force)
+				if errors.Is(err, snapshot.ErrPinned) {
+					return fmt.Errorf("%w. Unpin it, or use --force to delete it anyway", err)
+				}
+				if err != nil {
+					return fmt.Errorf("delete snapshot: %w", err)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false,
+		"delete pinned snapshots, and snapshots used by containers")
+	return cmd
+}
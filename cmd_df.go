@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newDFCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "df",
+		Short: "Show the disk space used by snapshots",
+		Long: "Show the disk space used by snapshots. Snapshots share the layers of their " +
+			"parents and base images, so each snapshot is only counted for the layers it " +
+			"added. Base images are counted once, however many snapshots use them.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			snapshots, err := snapshot.List(context.Background(), dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			var sources []string
+			bySource := map[string]*diskUsageSummary{}
+			var total diskUsageSummary
+			baseImages := map[string]int64{}
+			for _, snap := range snapshots {
+				source := sourceName(snap)
+				summary, ok := bySource[source]
+				if !ok {
+					summary = &diskUsageSummary{}
+					bySource[source] = summary
+					sources = append(sources, source)
+				}
+				summary.add(snap)
+				total.add(snap)
+
+				if snap.Size.BaseImageID != "" {
+					baseImages[snap.Size.BaseImageID] = snap.Size.Base
+				}
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "SOURCE\tSNAPSHOTS\tSIZE\tDUMPS\tVOLUMES\tPINNED")
+			for _, source := range sources {
+				bySource[source].print(w, source)
+			}
+			total.print(w, "TOTAL")
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			var baseSize int64
+			for _, size := range baseImages {
+				baseSize += size
+			}
+			fmt.Printf("\nThe snapshots are built on %d base images, which use %s.\n",
+				len(baseImages), formatSize(baseSize))
+			return nil
+		},
+	}
+}
+
+// diskUsageSummary is the disk space used by a set of snapshots.
+type diskUsageSummary struct {
+	snapshots int
+	size      int64
+	dumps     int64
+	volumes   int64
+
+	// pinned is the size of the snapshots that are pinned, and so can't be
+	// reclaimed by pruning.
+	pinned int64
+}
+
+func (s *diskUsageSummary) add(snap *snapshot.Snapshot) {
+	s.snapshots++
+	s.size += snap.Size.Unique
+	s.dumps += snap.Size.Dump
+	s.volumes += snap.Size.Volumes
+	if snap.Pinned {
+		s.pinned += snap.Size.Unique
+	}
+}
+
+func (s *diskUsageSummary) print(w *tabwriter.Writer, name string) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", name, s.snapshots,
+		formatSize(s.size), formatSize(s.dumps), formatSize(s.volumes), formatSize(s.pinned))
+}
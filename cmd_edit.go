@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newEditCommand() *cobra.Command {
+	var title, description string
+	var tags []string
+	cmd := &cobra.Command{
+		Use:   "edit SNAPSHOT",
+		Short: "Change the title, description, or tags of a snapshot",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			snap, err := snapshot.Find(snapshots, args[0])
+			if err != nil {
+				return err
+			}
+
+			// Only modify the fields that were explicitly set.
+			opts := snapshot.EditOptions{
+				Title:       snap.Title,
+				Description: snap.Description,
+				Tags:        snap.Tags,
+				Pinned:      snap.Pinned,
+			}
+			if cmd.Flags().Changed("title") {
+				opts.Title = title
+			}
+			if cmd.Flags().Changed("description") {
+				opts.Description = description
+			}
+			if cmd.Flags().Changed("tags") {
+				opts.Tags = tags
+			}
+
+			if err := snapshot.Edit(ctx, dockerClient, snap, opts); err != nil {
+				return fmt.Errorf("edit snapshot: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&title, "title", "", "the new title")
+	cmd.Flags().StringVar(&description, "description", "", "the new description")
+	cmd.Flags().StringSliceVar(&tags, "tags", nil, "the new comma separated tags")
+	return cmd
+}
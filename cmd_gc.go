@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/pkg/stringid"
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// gcMinAge is the default age of the leftovers removed by `dksnap gc`, and
+// by the garbage collection at startup. Newer helpers may belong to a dksnap
+// process that's still running, such as `dksnap daemon`, even if they were
+// created on another host that shares the Docker daemon.
+const gcMinAge = time.Hour
+
+func newGCCommand() *cobra.Command {
+	var minAge time.Duration
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the helper containers and images left behind by interrupted snapshots",
+		Long: "Remove the helper containers and intermediate images left behind when dksnap is " +
+			"killed in the middle of an operation. Intermediate images that snapshots are built " +
+			"on are kept. This also runs automatically whenever dksnap starts.",
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			result, err := snapshot.GC(context.Background(), dockerClient, minAge)
+			for _, id := range result.Containers {
+				fmt.Printf("Removed container %s\n", stringid.TruncateID(id))
+			}
+			for _, id := range result.Images {
+				fmt.Printf("Removed image %s\n", stringid.TruncateID(id))
+			}
+			return err
+		},
+	}
+	cmd.Flags().DurationVar(&minAge, "min-age", gcMinAge,
+		"only remove leftovers older than this, since newer ones may still be in use")
+	return cmd
+}
+
+// gcOnStartup removes leftovers from interrupted snapshots. Errors are
+// ignored, since they're reported by the command itself if Docker is
+// unavailable.
+func gcOnStartup(cmd *cobra.Command, _ []string) {
+	// `dksnap gc` collects garbage itself.
+	if cmd.Name() == "gc" {
+		return
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return
+	}
+	snapshot.GC(context.Background(), dockerClient, gcMinAge)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newInspectCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "inspect SNAPSHOT",
+		Short: "Show the metadata of a snapshot",
+		Long: "Show the metadata of a snapshot. SNAPSHOT can be an image name, " +
+			"an image ID, or a snapshot title.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			snapshots, err := snapshot.List(context.Background(), dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			snap, err := snapshot.Find(snapshots, args[0])
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			for _, detail := range describeSnapshot(snap) {
+				fmt.Fprintf(w, "%s:\t%s\n", detail.name, detail.value)
+			}
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List snapshots",
+		Args:  cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			snapshots, err := snapshot.List(context.Background(), dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tIMAGE\tCREATED\tSOURCE\tTYPE\tSIZE")
+			for _, snap := range snapshots {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+					snapshotNodeName(snap),
+					strings.Join(snap.ImageNames, ", "),
+					units.HumanDuration(time.Since(snap.Created))+" ago",
+					sourceName(snap),
+					snapshotterName(snap),
+					formatSize(snap.Size.Unique))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if len(snapshots) == 0 {
+				return nil
+			}
+
+			// The size of a tree is the size of its base image, plus the
+			// layers that each snapshot added.
+			fmt.Println()
+			fmt.Fprintln(w, "TREE\tSNAPSHOTS\tSIZE\tBASE SIZE")
+			for _, tree := range groupTrees(snapshots) {
+				var size int64
+				for _, snap := range tree.snapshots {
+					size += snap.Size.Unique
+				}
+				base := tree.snapshots[0].Size.Base
+				fmt.Fprintf(w, "%s\t%d\t%s\t%s\n",
+					snapshotNodeName(tree.root),
+					len(tree.snapshots),
+					formatSize(size+base),
+					formatSize(base))
+			}
+			return w.Flush()
+		},
+	}
+}
+
+// snapshotTree is a base image, or a snapshot without a parent, and the
+// snapshots descended from it.
+type snapshotTree struct {
+	root      *snapshot.Snapshot
+	snapshots []*snapshot.Snapshot
+}
+
+// groupTrees groups the snapshots by the root of their history. The trees
+// are ordered by their first snapshot.
+func groupTrees(snapshots []*snapshot.Snapshot) []*snapshotTree {
+	var trees []*snapshotTree
+	byRoot := map[*snapshot.Snapshot]*snapshotTree{}
+	for _, snap := range snapshots {
+		root := snap
+		// Bound the number of iterations in case of a cycle.
+		for i := 0; root.Parent != nil && i < len(snapshots); i++ {
+			root = root.Parent
+		}
+
+		tree, ok := byRoot[root]
+		if !ok {
+			tree = &snapshotTree{root: root}
+			byRoot[root] = tree
+			trees = append(trees, tree)
+		}
+		tree.snapshots = append(tree.snapshots, snap)
+	}
+	return trees
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newMigrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate [SNAPSHOT...]",
+		Short: "Upgrade the metadata of snapshots created by older versions of dksnap",
+		Long: "Upgrade the metadata of snapshots created by older versions of dksnap. " +
+			"Docker labels can't be modified, so each snapshot is replaced by a thin image " +
+			"with the new labels. If no snapshots are given, all outdated snapshots are migrated.",
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			toMigrate := snapshots
+			if len(args) != 0 {
+				toMigrate = nil
+				for _, ref := range args {
+					snap, err := snapshot.Find(snapshots, ref)
+					if err != nil {
+						return err
+					}
+					toMigrate = append(toMigrate, snap)
+				}
+			}
+
+			for _, snap := range toMigrate {
+				if snap.SchemaVersion >= snapshot.SchemaVersion {
+					continue
+				}
+
+				fmt.Printf("Migrating %q from schema version %d to %d\n",
+					snap.Title, snap.SchemaVersion, snapshot.SchemaVersion)
+				if err := snapshot.Migrate(ctx, dockerClient, snap); err != nil {
+					return fmt.Errorf("migrate %q: %w", snap.Title, err)
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newPinCommand() *cobra.Command {
+	var unpin bool
+	cmd := &cobra.Command{
+		Use:   "pin SNAPSHOT",
+		Short: "Pin a snapshot to protect it from being deleted or pruned",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			snap, err := snapshot.Find(snapshots, args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := snapshot.SetPinned(ctx, dockerClient, snap, !unpin); err != nil {
+				return fmt.Errorf("pin snapshot: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&unpin, "unpin", false, "unpin the snapshot instead")
+	return cmd
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newPruneCommand() *cobra.Command {
+	var keepLast int
+	var maxAge string
+	var dryRun, force bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove old snapshots according to a retention policy",
+		Long: "Remove old snapshots according to a retention policy. The policy defaults to " +
+			"the retention settings in the config file. Pinned snapshots, and snapshots that " +
+			"kept snapshots were created from, are kept unless --force is set.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			retention := cfg.Retention
+			if cmd.Flags().Changed("keep-last") {
+				retention.KeepLast = keepLast
+			}
+			if cmd.Flags().Changed("max-age") {
+				retention.MaxAge = maxAge
+			}
+			policy, err := retention.policy()
+			if err != nil {
+				return err
+			}
+			policy.PrunePinned = force
+			if policy.KeepLast == 0 && policy.MaxAge == 0 {
+				return errors.New("no retention policy. Set --keep-last or --max-age")
+			}
+
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			return prune(ctx, dockerClient, policy, dryRun)
+		},
+	}
+	cmd.Flags().IntVar(&keepLast, "keep-last", 0,
+		"the number of snapshots to keep for each container or volume")
+	cmd.Flags().StringVar(&maxAge, "max-age", "",
+		`remove snapshots older than this age, such as "72h" or "30d"`)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the snapshots that would be removed")
+	cmd.Flags().BoolVar(&force, "force", false,
+		"also remove pinned snapshots, and snapshots used by containers")
+	return cmd
+}
+
+// prune removes the snapshots that break the retention policy, and prints
+// what it's doing.
+func prune(ctx context.Context, dockerClient *client.Client, policy snapshot.RetentionPolicy, dryRun bool) error {
+	snapshots, err := snapshot.List(ctx, dockerClient)
+	if err != nil {
+		return fmt.Errorf("list snapshots: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tNAME\tIMAGE\tCREATED\tREASON")
+	var failed int
+	for _, decision := range snapshot.PlanPrune(snapshots, policy, time.Now()) {
+		snap := decision.Snapshot
+		action := "keep"
+		if decision.Remove {
+			action = "remove"
+			if dryRun {
+				action = "would remove"
+			} else if err := snapshot.Remove(ctx, dockerClient, snap, policy.PrunePinned); err != nil {
+				action = "failed"
+				decision.Reason = err.Error()
+				failed++
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			action,
+			snap.Title,
+			strings.Join(snap.ImageNames, ", "),
+			units.HumanDuration(time.Since(snap.Created))+" ago",
+			decision.Reason)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to remove %d snapshots", failed)
+	}
+	return nil
+}
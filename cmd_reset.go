@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newResetCommand() *cobra.Command {
+	var yes bool
+	cmd := &cobra.Command{
+		Use:   "reset CONTAINER",
+		Short: "Throw away changes made to a container booted from a snapshot",
+		Long: "Throw away changes made to a container booted from a snapshot by restarting " +
+			"it with the snapshot's data. Snapshots are only restored the first time a " +
+			"container boots, so regular restarts keep the container's data.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), snapshot.ReadyTimeout)
+			defer cancel()
+			containers, err := listContainers(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list containers: %w", err)
+			}
+
+			container, err := findContainer(containers, args[0])
+			if err != nil {
+				return err
+			}
+
+			if container.FromSnapshot != nil && !yes {
+				if paths := overwrittenBindPaths(container.FromSnapshot, container); len(paths) != 0 {
+					return fmt.Errorf("%s\nRerun with --yes to continue", overwriteWarning(paths))
+				}
+			}
+			return snapshot.Reset(ctx, dockerClient, container.ID, os.Stderr)
+		},
+	}
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false,
+		"overwrite any host directories that are bind mounted into the container without asking")
+	return cmd
+}
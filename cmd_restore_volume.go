@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newRestoreVolumeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore-volume SNAPSHOT [VOLUME]",
+		Short: "Restore a volume snapshot into a named volume",
+		Long: "Replace the contents of a named volume with a volume snapshot. The volume " +
+			"defaults to the volume that the snapshot was created from, and is created " +
+			"if it doesn't exist.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			snap, err := snapshot.Find(snapshots, args[0])
+			if err != nil {
+				return err
+			}
+
+			volume := snap.Source.Volume
+			if len(args) == 2 {
+				volume = args[1]
+			}
+			if volume == "" {
+				return errors.New("a volume is required")
+			}
+			return snapshot.RestoreVolume(ctx, dockerClient, snap, volume)
+		},
+	}
+}
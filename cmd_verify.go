@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+func newVerifyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify SNAPSHOT...",
+		Short: "Check that the data in snapshots hasn't been corrupted",
+		Long: "Check that the data in snapshots hasn't been corrupted or tampered with. " +
+			"The checksums of the database dump and volume contents are recomputed from the " +
+			"image, and compared to the checksums recorded when the snapshot was created.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			ctx := context.Background()
+			snapshots, err := snapshot.List(ctx, dockerClient)
+			if err != nil {
+				return fmt.Errorf("list snapshots: %w", err)
+			}
+
+			corrupted := false
+			for _, ref := range args {
+				snap, err := snapshot.Find(snapshots, ref)
+				if err != nil {
+					return err
+				}
+
+				results, err := snapshot.Verify(ctx, dockerClient, snap)
+				if err != nil {
+					return fmt.Errorf("verify %q: %w", snap.Title, err)
+				}
+
+				for _, result := range results {
+					if result.OK() {
+						fmt.Printf("%s: %s: OK\n", snap.Title, result.Path)
+						continue
+					}
+
+					corrupted = true
+					fmt.Printf("%s: %s: MISMATCH (expected %s, got %s)\n",
+						snap.Title, result.Path, result.Expected, result.Actual)
+				}
+			}
+
+			if corrupted {
+				return errors.New("snapshot data doesn't match the recorded checksums")
+			}
+			return nil
+		},
+	}
+}
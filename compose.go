@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// The labels used by docker-compose to track the containers it owns.
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeServiceLabel     = "com.docker.compose.service"
+	composeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+)
+
+// composeOverrideFile is the file that docker-compose automatically merges
+// into the project's configuration.
+const composeOverrideFile = "docker-compose.override.yml"
+
+// composeDefaultFiles are the file names that docker-compose loads when no
+// files are given with -f. composeOverrideFile is only merged automatically
+// into projects that use them.
+var composeDefaultFiles = map[string]bool{
+	"docker-compose.yml":           true,
+	"docker-compose.yaml":          true,
+	"docker-compose.override.yml":  true,
+	"docker-compose.override.yaml": true,
+}
+
+// composeOverrideHeader marks override files generated by dksnap, so that we
+// never overwrite override files written by the user.
+const composeOverrideHeader = "# Generated by dksnap."
+
+var (
+	composeVersionPattern = regexp.MustCompile(`(?m)^version:\s*['"]?([0-9.]+)['"]?\s*$`)
+	composePinPattern     = regexp.MustCompile(`(?m)^  ([^\s:]+):\n    image: "([^"]*)"$`)
+)
+
+// composeService describes the docker-compose service that a container
+// belongs to.
+type composeService struct {
+	project     string
+	service     string
+	workingDir  string
+	configFiles []string
+}
+
+// getComposeService returns the docker-compose service of the container, if
+// it was created by docker-compose.
+func getComposeService(container types.ContainerJSON) (composeService, bool) {
+	if container.Config == nil {
+		return composeService{}, false
+	}
+
+	labels := container.Config.Labels
+	project, ok := labels[composeProjectLabel]
+	if !ok {
+		return composeService{}, false
+	}
+
+	svc := composeService{
+		project:    project,
+		service:    labels[composeServiceLabel],
+		workingDir: labels[composeWorkingDirLabel],
+	}
+	for _, path := range strings.Split(labels[composeConfigFilesLabel], ",") {
+		if path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(svc.workingDir, path)
+		}
+		svc.configFiles = append(svc.configFiles, path)
+	}
+	return svc, true
+}
+
+// usesDefaultFiles returns whether the project was started with
+// docker-compose's default file names, so that it automatically loads
+// composeOverrideFile. Older versions of docker-compose don't record the
+// project's files, in which case the defaults are assumed.
+func (svc composeService) usesDefaultFiles() bool {
+	for _, path := range svc.configFiles {
+		if filepath.Dir(path) != filepath.Clean(svc.workingDir) || !composeDefaultFiles[filepath.Base(path)] {
+			return false
+		}
+	}
+	return true
+}
+
+// pinComposeImage writes a docker-compose override file that pins the
+// service to the given image. Without it, docker-compose considers the
+// container out of date since its image doesn't match the service's image,
+// and the next `docker-compose up` recreates it from the original image.
+//
+// The override file is only modified if it doesn't exist, or was generated
+// by dksnap. The path of the override file is returned.
+func pinComposeImage(svc composeService, image string) (string, error) {
+	if svc.workingDir == "" {
+		return "", errors.New("docker-compose didn't record the project's directory")
+	}
+
+	overridePath := filepath.Join(svc.workingDir, composeOverrideFile)
+	pins := map[string]string{}
+	existing, err := ioutil.ReadFile(overridePath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return "", fmt.Errorf("read %s: %w", overridePath, err)
+	case !bytes.HasPrefix(existing, []byte(composeOverrideHeader)):
+		return "", fmt.Errorf("%s already exists. Set the image of the %s service to %s in it manually",
+			overridePath, svc.service, image)
+	default:
+		for _, match := range composePinPattern.FindAllStringSubmatch(string(existing), -1) {
+			pins[match[1]] = match[2]
+		}
+	}
+	pins[svc.service] = image
+
+	version, err := getComposeVersion(svc.configFiles)
+	if err != nil {
+		return "", fmt.Errorf("get docker-compose file version: %w", err)
+	}
+
+	var services []string
+	for service := range pins {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var override bytes.Buffer
+	fmt.Fprintln(&override, composeOverrideHeader)
+	fmt.Fprintln(&override, "# It pins services to the dksnap snapshots that replaced them. Delete this")
+	fmt.Fprintln(&override, "# file to go back to the images defined in the main docker-compose file.")
+	if version != "" {
+		fmt.Fprintf(&override, "version: %q\n", version)
+	}
+	fmt.Fprintln(&override, "services:")
+	for _, service := range services {
+		fmt.Fprintf(&override, "  %s:\n    image: %q\n", service, pins[service])
+	}
+
+	if err := ioutil.WriteFile(overridePath, override.Bytes(), 0644); err != nil {
+		return "", fmt.Errorf("write %s: %w", overridePath, err)
+	}
+	return overridePath, nil
+}
+
+// getComposeVersion returns the version declared by the first docker-compose
+// file. docker-compose requires override files to use the same version as
+// the files they extend.
+func getComposeVersion(configFiles []string) (string, error) {
+	if len(configFiles) == 0 {
+		return "", nil
+	}
+
+	config, err := ioutil.ReadFile(configFiles[0])
+	if err != nil {
+		return "", err
+	}
+
+	match := composeVersionPattern.FindSubmatch(config)
+	if match == nil {
+		return "", nil
+	}
+	return string(match[1]), nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// config contains the user's dksnap settings. It's read from
+// dksnap/config.json in the user's config directory, such as
+// ~/.config/dksnap/config.json on Linux.
+type config struct {
+	// Exclude are glob patterns for files that generic snapshots don't
+	// capture from volumes, such as `node_modules` or `*.log`.
+	Exclude []string `json:"exclude"`
+
+	// Retention is the default retention policy used by `dksnap prune`.
+	Retention retentionConfig `json:"retention"`
+
+	// Schedules are the automatic snapshots taken by `dksnap daemon` at
+	// regular times.
+	Schedules []scheduleConfig `json:"schedules"`
+
+	// Rules are the automatic snapshots taken by `dksnap daemon` in
+	// response to Docker events.
+	Rules []ruleConfig `json:"rules"`
+
+	// Hooks are commands that run before and after containers are
+	// snapshotted.
+	Hooks []hookConfig `json:"hooks"`
+}
+
+// hookConfig describes the hooks that run when containers created from an
+// image are snapshotted.
+type hookConfig struct {
+	// Image is the name of the image, such as "mysql" or "mysql:8". It can
+	// be a glob pattern, such as "*/postgres".
+	Image string `json:"image"`
+
+	// Pre and Post are the commands that run before and after the
+	// snapshot.
+	Pre  []hookCommandConfig `json:"pre"`
+	Post []hookCommandConfig `json:"post"`
+}
+
+// hookCommandConfig is the JSON representation of a snapshot.Hook.
+type hookCommandConfig struct {
+	Command string `json:"command"`
+
+	// Host runs the command on the host rather than inside the container.
+	Host bool `json:"host"`
+}
+
+// validate returns an error if the hooks are incomplete.
+func (c hookConfig) validate() error {
+	if c.Image == "" {
+		return errors.New("hooks require an image")
+	}
+	if _, err := filepath.Match(c.Image, ""); err != nil {
+		return fmt.Errorf("malformed image pattern %q: %w", c.Image, err)
+	}
+	for _, hook := range append(append([]hookCommandConfig{}, c.Pre...), c.Post...) {
+		if strings.TrimSpace(hook.Command) == "" {
+			return fmt.Errorf("hooks for %s: missing command", c.Image)
+		}
+	}
+	return nil
+}
+
+// automationConfig contains the settings shared by schedules and rules.
+type automationConfig struct {
+	// Name identifies the snapshots created by the schedule or rule, so
+	// that the retention policy only applies to them.
+	Name string `json:"name"`
+
+	// Title is a text/template for the titles of the snapshots. See
+	// titleData for the available fields.
+	Title string `json:"title"`
+
+	// Consistency is the consistency mode of generic snapshots.
+	Consistency string `json:"consistency"`
+
+	// Retention is the retention policy for the snapshots.
+	Retention retentionConfig `json:"retention"`
+}
+
+// scheduleConfig describes a set of containers that are automatically
+// snapshotted at regular times.
+type scheduleConfig struct {
+	automationConfig
+
+	// Containers are the names of the containers to snapshot. Each
+	// container is snapshotted separately.
+	Containers []string `json:"containers"`
+
+	// Project is the name of a docker-compose project whose containers are
+	// snapshotted together as a group.
+	Project string `json:"project"`
+
+	// Either Every or Cron sets when the snapshots are taken. Every is an
+	// interval such as "1h", and Cron is a cron expression such as
+	// "0 9-17 * * 1-5".
+	Every string `json:"every"`
+	Cron  string `json:"cron"`
+}
+
+// ruleConfig describes containers that are automatically snapshotted when
+// something happens to them.
+type ruleConfig struct {
+	automationConfig
+
+	// On is the event that triggers the snapshot. See ruleTriggers for the
+	// supported events.
+	On string `json:"on"`
+
+	// Containers and Label select the containers that the rule applies
+	// to. Label is either a label key, or a key=value pair.
+	Containers []string `json:"containers"`
+	Label      string   `json:"label"`
+
+	// Command is the name of the executable that triggers exec rules, such
+	// as "migrate".
+	Command string `json:"command"`
+}
+
+// retentionConfig is the JSON representation of a snapshot.RetentionPolicy.
+type retentionConfig struct {
+	KeepLast int `json:"keepLast"`
+
+	// MaxAge is a duration such as "72h" or "30d".
+	MaxAge string `json:"maxAge"`
+}
+
+// policy parses the retention policy.
+func (c retentionConfig) policy() (snapshot.RetentionPolicy, error) {
+	policy := snapshot.RetentionPolicy{KeepLast: c.KeepLast}
+	if c.KeepLast < 0 {
+		return policy, errors.New("the number of snapshots to keep can't be negative")
+	}
+
+	if c.MaxAge != "" {
+		maxAge, err := parseAge(c.MaxAge)
+		if err != nil {
+			return policy, err
+		}
+		policy.MaxAge = maxAge
+	}
+	return policy, nil
+}
+
+// parseAge parses a duration. In addition to the units supported by
+// time.ParseDuration, whole days can be given with the "d" suffix.
+func parseAge(age string) (time.Duration, error) {
+	if days := strings.TrimSuffix(age, "d"); days != age {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("malformed age %q", age)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("malformed age %q", age)
+	}
+	return duration, nil
+}
+
+// configPath returns the path of the config file. It can be overridden with
+// the DKSNAP_CONFIG environment variable.
+func configPath() (string, error) {
+	if path := os.Getenv("DKSNAP_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("get config directory: %w", err)
+	}
+	return filepath.Join(configDir, "dksnap", "config.json"), nil
+}
+
+// loadConfig reads the config file. The default settings are used if it
+// doesn't exist.
+func loadConfig() (config, error) {
+	var cfg config
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	configJSON, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("read config: %w", err)
+	}
+
+	if err := json.Unmarshal(configJSON, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if err := snapshot.ValidateExcludePatterns(cfg.Exclude); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if _, err := cfg.Retention.policy(); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	for _, hooks := range cfg.Hooks {
+		if err := hooks.validate(); err != nil {
+			return cfg, fmt.Errorf("parse config %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
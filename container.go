@@ -15,11 +15,9 @@ import (
 	"github.com/kelda/dksnap/pkg/snapshot"
 )
 
-// Container represents a running container that can be snapshotted.
+// Container represents a container that can be snapshotted.
 type Container struct {
-	HasPostgres  bool
-	HasMongo     bool
-	HasMySQL     bool
+	Databases    snapshot.Databases
 	FromSnapshot *snapshot.Snapshot
 	types.ContainerJSON
 }
@@ -35,6 +33,7 @@ const (
 	containerImageColumnIndex = iota
 	containerSnapshotColumnIndex
 	containerCreatedColumnIndex
+	containerStatusColumnIndex
 	containerNameColumnIndex
 )
 
@@ -49,11 +48,23 @@ func NewContainerSelector(client *client.Client, selectedFunc func(Container), d
 	}
 }
 
-// Sync updates the listed containers with the latest running containers.
+// Sync updates the listed containers with the latest containers.
 func (cs *ContainerSelector) Sync(ctx context.Context) error {
-	snapshots, err := snapshot.List(ctx, cs.client)
+	containers, err := listContainers(ctx, cs.client)
 	if err != nil {
-		return fmt.Errorf("list snapshots: %w", err)
+		return err
+	}
+
+	cs.draw(containers)
+	return nil
+}
+
+// listContainers returns all containers, including stopped containers, along
+// with the databases running in them.
+func listContainers(ctx context.Context, dockerClient *client.Client) ([]Container, error) {
+	snapshots, err := snapshot.List(ctx, dockerClient)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
 	}
 
 	snapshotByImageID := map[string]*snapshot.Snapshot{}
@@ -61,56 +72,28 @@ func (cs *ContainerSelector) Sync(ctx context.Context) error {
 		snapshotByImageID[snapshot.ImageID] = snapshot
 	}
 
-	containerIDs, err := cs.client.ContainerList(ctx, types.ContainerListOptions{})
+	containerIDs, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
 	if err != nil {
-		return fmt.Errorf("list containers: %w", err)
+		return nil, fmt.Errorf("list containers: %w", err)
 	}
 
 	var containers []Container
 	for _, containerID := range containerIDs {
-		containerInfo, err := cs.client.ContainerInspect(ctx, containerID.ID)
-		if err != nil {
-			return fmt.Errorf("inspect container: %w", err)
-		}
-
-		var hasPostgres, hasMongo, hasMySQL bool
-		topResp, err := cs.client.ContainerTop(ctx, containerID.ID, []string{"-eo", "pid,comm"})
+		containerInfo, err := dockerClient.ContainerInspect(ctx, containerID.ID)
 		if err != nil {
-			// The container was stopped between the list and top.
-			if strings.Contains(err.Error(), "is not running") {
-				continue
-			}
-		} else {
-			for _, process := range topResp.Processes {
-				if len(process) != 2 {
-					continue
-				}
-
-				switch {
-				case strings.Contains(process[1], "postgres"):
-					hasPostgres = true
-				case strings.Contains(process[1], "mongo"):
-					hasMongo = true
-				case strings.Contains(process[1], "mysql"):
-					hasMySQL = true
-				}
-			}
+			return nil, fmt.Errorf("inspect container: %w", err)
 		}
 
 		// Reference the image by the user-friendly name.
 		imageID := containerInfo.Image
 		containerInfo.Image = containerID.Image
 		containers = append(containers, Container{
-			HasPostgres:   hasPostgres,
-			HasMongo:      hasMongo,
-			HasMySQL:      hasMySQL,
+			Databases:     snapshot.DetectDatabases(ctx, dockerClient, containerInfo),
 			FromSnapshot:  snapshotByImageID[imageID],
 			ContainerJSON: containerInfo,
 		})
 	}
-
-	cs.draw(containers)
-	return nil
+	return containers, nil
 }
 
 func (cs *ContainerSelector) draw(containers []Container) {
@@ -139,6 +122,12 @@ func (cs *ContainerSelector) draw(containers []Container) {
 		Expansion:     1,
 		NotSelectable: true,
 	})
+	cs.SetCell(0, containerStatusColumnIndex, &tview.TableCell{
+		Text:          "STATUS",
+		Color:         tcell.ColorYellow,
+		Expansion:     1,
+		NotSelectable: true,
+	})
 	cs.SetCell(0, containerNameColumnIndex, &tview.TableCell{
 		Text:          "NAME",
 		Color:         tcell.ColorYellow,
@@ -166,6 +155,7 @@ func (cs *ContainerSelector) draw(containers []Container) {
 		cs.SetCellSimple(row, containerImageColumnIndex, container.Image)
 		cs.SetCellSimple(row, containerSnapshotColumnIndex, snapshotTitle)
 		cs.SetCellSimple(row, containerCreatedColumnIndex, created)
+		cs.SetCellSimple(row, containerStatusColumnIndex, containerStatus(container))
 		cs.SetCellSimple(row, containerNameColumnIndex, strings.TrimPrefix(container.Name, "/"))
 	}
 
@@ -178,3 +168,22 @@ func (cs *ContainerSelector) draw(containers []Container) {
 		cs.selectedFunc(containers[containerIndex])
 	})
 }
+
+// containerStatus returns a short description of whether the container is
+// running.
+func containerStatus(container Container) string {
+	state := container.State
+	switch {
+	case state == nil:
+		return "unknown"
+	case state.Status == "exited":
+		return fmt.Sprintf("exited (%d)", state.ExitCode)
+	default:
+		return state.Status
+	}
+}
+
+// isRunning returns whether the container is running.
+func isRunning(container Container) bool {
+	return container.State != nil && container.State.Running
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/gdamore/tcell"
@@ -17,16 +18,18 @@ import (
 
 type createUI struct {
 	client *client.Client
+	config config
 
 	app               *tview.Application
 	containerSelector *ContainerSelector
 	*tview.Pages
 }
 
-func newCreateUI(client *client.Client, app *tview.Application) *createUI {
+func newCreateUI(client *client.Client, cfg config, app *tview.Application) *createUI {
 	ui := &createUI{
 		app:    app,
 		client: client,
+		config: cfg,
 		Pages:  tview.NewPages(),
 	}
 	ui.containerSelector = NewContainerSelector(client, ui.promptCreateSnapshot, nil)
@@ -40,7 +43,7 @@ func (ui *createUI) run(ctx context.Context) {
 	}
 	ui.app.Draw()
 
-	for range newEventsTrigger(ctx, ui.client, "container", "start", "die") {
+	for range newEventsTrigger(ctx, ui.client, "container", "create", "start", "die", "destroy") {
 		if err := ui.containerSelector.Sync(ctx); err != nil {
 			continue
 		}
@@ -50,6 +53,24 @@ func (ui *createUI) run(ctx context.Context) {
 
 func newEventsTrigger(ctx context.Context, client *client.Client, eventType string, actions ...string) chan struct{} {
 	trigger := make(chan struct{}, 1)
+	events := watchEvents(ctx, client, eventType, actions...)
+	go func() {
+		for range events {
+			select {
+			case trigger <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return trigger
+}
+
+// watchEvents returns the Docker events of the given type whose action is in
+// actions. Actions with arguments, such as "health_status: healthy", are
+// matched by the part before the colon.
+func watchEvents(ctx context.Context, client *client.Client, eventType string,
+	actions ...string) <-chan events.Message {
+	matched := make(chan events.Message)
 
 	actionsSet := map[string]struct{}{}
 	for _, action := range actions {
@@ -57,25 +78,67 @@ func newEventsTrigger(ctx context.Context, client *client.Client, eventType stri
 	}
 
 	go func() {
-		events, _ := client.Events(ctx, types.EventsOptions{
-			Filters: filters.NewArgs(filters.Arg("Type", eventType)),
-		})
-		for e := range events {
-			if _, ok := actionsSet[e.Action]; !ok {
-				continue
+		defer close(matched)
+
+		// Resubscribe if the connection to Docker is lost, starting from the
+		// last event that was received so that nothing is missed.
+		var since string
+		for {
+			messages, errs := client.Events(ctx, types.EventsOptions{
+				Since:   since,
+				Filters: filters.NewArgs(filters.Arg("Type", eventType)),
+			})
+
+		receive:
+			for {
+				select {
+				case e := <-messages:
+					// Docker includes events at the since time, so skip
+					// past the event that was just received.
+					next := e.TimeNano + 1
+					since = fmt.Sprintf("%d.%09d", next/int64(time.Second), next%int64(time.Second))
+
+					action := strings.SplitN(e.Action, ":", 2)[0]
+					if _, ok := actionsSet[action]; !ok {
+						continue
+					}
+
+					select {
+					case matched <- e:
+					case <-ctx.Done():
+						return
+					}
+				case <-errs:
+					break receive
+				}
 			}
 
 			select {
-			case trigger <- struct{}{}:
-			default:
+			case <-ctx.Done():
+				return
+			case <-time.After(eventsRetryInterval):
 			}
 		}
 	}()
 
-	return trigger
+	return matched
+}
+
+// eventsRetryInterval is how long to wait before resubscribing to Docker
+// events after the connection is lost.
+const eventsRetryInterval = 5 * time.Second
+
+// consistencyOptions are the consistency modes that can be picked when
+// creating snapshots. The first option is the default.
+var consistencyOptions = []string{
+	string(snapshot.ConsistencyLive),
+	string(snapshot.ConsistencyPause),
+	string(snapshot.ConsistencyStop),
 }
 
 func (ui *createUI) promptCreateSnapshot(container Container) {
+	var projectCheckbox, dumpStoppedCheckbox *tview.Checkbox
+	mountCheckboxes := map[string]*tview.Checkbox{}
 	form := tview.NewForm().
 		Clear(true)
 	form.SetBorder(true).
@@ -84,6 +147,8 @@ func (ui *createUI) promptCreateSnapshot(container Container) {
 	form.
 		AddInputField("Title", "", 20, nil, nil).
 		AddInputField("Image Name", "", 20, nil, nil).
+		AddDropDown("Consistency", consistencyOptions, 0, nil).
+		AddInputField("Exclude", strings.Join(ui.config.Exclude, ", "), 40, nil, nil).
 		AddButton("Create Snapshot", func() {
 			title := form.GetFormItemByLabel("Title").(*tview.InputField).GetText()
 			imageName := form.GetFormItemByLabel("Image Name").(*tview.InputField).GetText()
@@ -92,12 +157,27 @@ func (ui *createUI) promptCreateSnapshot(container Container) {
 				return
 			}
 
+			exclude := snapshot.ParseExcludePatterns(form.GetFormItemByLabel("Exclude").(*tview.InputField).GetText())
+			if err := snapshot.ValidateExcludePatterns(exclude); err != nil {
+				alert(ui.app, ui.Pages, err.Error(), form)
+				return
+			}
+
 			var dbUser string
 			dbUserInput := form.GetFormItemByLabel("Database User")
 			if dbUserInput != nil {
 				dbUser = dbUserInput.(*tview.InputField).GetText()
 			}
 
+			snapshotProject := projectCheckbox != nil && projectCheckbox.IsChecked()
+			mounts := []string{}
+			for destination, checkbox := range mountCheckboxes {
+				if checkbox.IsChecked() {
+					mounts = append(mounts, destination)
+				}
+			}
+			dumpStopped := dumpStoppedCheckbox != nil && dumpStoppedCheckbox.IsChecked()
+
 			snapshotLogs := tview.NewTextView().
 				SetDynamicColors(true).
 				SetChangedFunc(func() {
@@ -114,8 +194,22 @@ func (ui *createUI) promptCreateSnapshot(container Container) {
 			modal := newModal(modalContents, 60, 10)
 			ui.Pages.AddPage("snapshot-status", modal, true, true)
 
+			_, consistency := form.GetFormItemByLabel("Consistency").(*tview.DropDown).GetCurrentOption()
+			opts := snapshot.CreateOptions{
+				Title:       title,
+				ImageName:   imageName,
+				Consistency: snapshot.Consistency(consistency),
+				Exclude:     exclude,
+			}
 			go func() {
-				ui.createSnapshot(snapshotLogs, container, title, imageName, dbUser)
+				// The mounts are chosen for the selected container, so they
+				// don't apply to the rest of the project.
+				if snapshotProject {
+					ui.createGroupSnapshot(snapshotLogs, container, opts)
+				} else {
+					opts.Mounts = mounts
+					ui.createSnapshot(snapshotLogs, container, opts, dbUser, dumpStopped)
+				}
 				ui.app.QueueUpdateDraw(func() {
 					exitButton := tview.NewButton("OK").SetSelectedFunc(func() {
 						ui.Pages.RemovePage("snapshot-status")
@@ -131,60 +225,96 @@ func (ui *createUI) promptCreateSnapshot(container Container) {
 	titleInput := form.GetFormItemByLabel("Title").(*tview.InputField)
 	imageNameInput := form.GetFormItemByLabel("Image Name").(*tview.InputField)
 	submitButton := form.GetButton(form.GetButtonIndex("Create Snapshot"))
-	inputFields := []*tview.InputField{
+	inputFields := []formField{
 		titleInput,
 		imageNameInput,
+		form.GetFormItemByLabel("Consistency").(formField),
+		form.GetFormItemByLabel("Exclude").(formField),
 	}
 
 	// We need the user to dump as when taking Postgres snapshots.
-	if !*forceGenericSnapshot && container.HasPostgres {
-		dbUser, ok := getEnv(container.Config.Env, "POSTGRES_USER")
-		if !ok {
-			dbUser = "postgres"
-		}
+	if !forceGenericSnapshot && container.Databases.Postgres {
+		form.AddInputField("Database User", snapshot.DefaultPostgresUser(container.ContainerJSON), 20, nil, nil)
+		inputFields = append(inputFields, form.GetFormItemByLabel("Database User").(formField))
+	}
+
+	// Databases can only be dumped from stopped containers by booting a
+	// temporary copy of the container, so let the user decide whether to do
+	// that or to fall back to a generic snapshot.
+	if !forceGenericSnapshot && container.Databases.Any() && !isRunning(container) {
+		form.AddCheckbox("Dump From Temporary Copy", false, nil)
+		dumpStoppedCheckbox = form.GetFormItemByLabel("Dump From Temporary Copy").(*tview.Checkbox)
+		inputFields = append(inputFields, dumpStoppedCheckbox)
+	}
+
+	// Let the user choose which mounts are captured by generic snapshots.
+	for _, mount := range snapshot.ContainerMounts(container.ContainerJSON) {
+		label := fmt.Sprintf("Capture %s (%s)", mount.Destination, mount.Type)
+		form.AddCheckbox(label, snapshot.CapturedByDefault(mount), nil)
+		mountCheckboxes[mount.Destination] = form.GetFormItemByLabel(label).(*tview.Checkbox)
+		inputFields = append(inputFields, mountCheckboxes[mount.Destination])
+	}
 
-		form.AddInputField("Database User", dbUser, 20, nil, nil)
-		inputFields = append(inputFields, form.GetFormItemByLabel("Database User").(*tview.InputField))
+	// Offer to snapshot the rest of the container's docker-compose project
+	// at the same time.
+	if _, ok := getComposeService(container.ContainerJSON); ok {
+		form.AddCheckbox("Entire Compose Project", false, nil)
+		projectCheckbox = form.GetFormItemByLabel("Entire Compose Project").(*tview.Checkbox)
+		inputFields = append(inputFields, projectCheckbox)
 	}
 
 	// Automatically generate image names based on the snapshot title.
 	titleInput.SetChangedFunc(func(name string) {
-		image := strings.ToLower(name)
-
-		// Convert spaces into a legal separator.
-		image = strings.Replace(image, " ", "-", -1)
+		imageNameInput.SetText(snapshot.ImageNameForTitle(name))
+	})
 
-		// Remove all other illegal characters.
-		image = regexp.MustCompile(`[^\w.-]`).ReplaceAllString(image, "")
+	setupFormNavigation(ui.app, inputFields, submitButton)
 
-		imageNameInput.SetText(image)
+	// Show the form.
+	height := 8 + 2*len(inputFields)
+	if height < 20 {
+		height = 20
+	}
+	ui.Pages.AddPage("create-snapshot-form", newModal(form, 70, height), true, true)
+	ui.app.SetFocus(form)
+	form.SetCancelFunc(func() {
+		ui.Pages.RemovePage("create-snapshot-form")
 	})
+}
 
-	// Allow navigating between the fields with arrow keys.
-	for i, inputField := range inputFields {
+// formField is a form item whose key presses can be intercepted.
+type formField interface {
+	tview.Primitive
+	SetInputCapture(capture func(event *tcell.EventKey) *tcell.EventKey) *tview.Box
+}
+
+// setupFormNavigation allows navigating between the fields of a form and its
+// submit button with the arrow keys.
+func setupFormNavigation(app *tview.Application, fields []formField, submitButton *tview.Button) {
+	for i, field := range fields {
 		i := i
 		isFirstField := i == 0
-		isLastField := i == len(inputFields)-1
-		inputField.SetInputCapture(
+		isLastField := i == len(fields)-1
+		field.SetInputCapture(
 			func(event *tcell.EventKey) *tcell.EventKey {
 				nextInput := func() {
 					if isLastField {
-						ui.app.SetFocus(submitButton)
+						app.SetFocus(submitButton)
 						return
 					}
 
-					target := (i + 1) % len(inputFields)
-					ui.app.SetFocus(inputFields[target])
+					target := (i + 1) % len(fields)
+					app.SetFocus(fields[target])
 				}
 
 				prevInput := func() {
 					if isFirstField {
-						ui.app.SetFocus(submitButton)
+						app.SetFocus(submitButton)
 						return
 					}
 
-					target := (i - 1) % len(inputFields)
-					ui.app.SetFocus(inputFields[target])
+					target := (i - 1) % len(fields)
+					app.SetFocus(fields[target])
 				}
 
 				switch event.Key() {
@@ -204,73 +334,105 @@ func (ui *createUI) promptCreateSnapshot(container Container) {
 		func(event *tcell.EventKey) *tcell.EventKey {
 			switch event.Key() {
 			case tcell.KeyUp:
-				ui.app.SetFocus(inputFields[len(inputFields)-1])
+				app.SetFocus(fields[len(fields)-1])
 				return nil
 			case tcell.KeyDown:
-				ui.app.SetFocus(inputFields[0])
+				app.SetFocus(fields[0])
 				return nil
 			default:
 				return event
 			}
 		})
-
-	// Show the form.
-	ui.Pages.AddPage("create-snapshot-form", newModal(form, 50, 20), true, true)
-	ui.app.SetFocus(form)
-	form.SetCancelFunc(func() {
-		ui.Pages.RemovePage("create-snapshot-form")
-	})
 }
 
-// createSnapshot takes a snapshot of the given container. It attempts to use
-// the database aware snapshot implementation first, but falls back to a
-// generic snapshot if that fails.
-func (ui *createUI) createSnapshot(out *tview.TextView, container Container, title, imageName, dbUser string) {
-	fmt.Fprintf(out, "Creating snapshot..")
-	pp := NewProgressPrinter(out)
-	pp.Start()
-
-	// Take the database aware snapshot.
-	var snapshotter snapshot.Snapshotter
-	switch {
-	case !*forceGenericSnapshot && container.HasPostgres:
-		snapshotter = snapshot.NewPostgres(ui.client, dbUser)
-	case !*forceGenericSnapshot && container.HasMongo:
-		snapshotter = snapshot.NewMongo(ui.client)
-	case !*forceGenericSnapshot && container.HasMySQL:
-		snapshotter = snapshot.NewMySQL(ui.client)
-	default:
-		snapshotter = snapshot.NewGeneric(ui.client)
+// createSnapshot takes a snapshot of the given container, and displays the
+// progress in out.
+func (ui *createUI) createSnapshot(out *tview.TextView, container Container, opts snapshot.CreateOptions,
+	dbUser string, dumpStopped bool) {
+	ctx := context.Background()
+	target := hookTarget{
+		container: container,
+		hooks:     containerHooks(ui.config.Hooks, container),
+		imageName: opts.ImageName,
 	}
 
-	err := snapshotter.Create(context.Background(), container.ContainerJSON, title, imageName)
-	pp.Stop()
-	out.Clear()
-	out.SetTextAlign(tview.AlignCenter)
+	// The output of the hooks is shown above the snapshot's progress, so it
+	// isn't cleared when showing the result.
+	showResult := func() {
+		if len(target.hooks) == 0 {
+			out.Clear()
+			out.SetTextAlign(tview.AlignCenter)
+		}
+	}
+
+	pp := NewProgressPrinter(out)
+	var fellBack bool
+	err := withHooks(ctx, ui.client, []hookTarget{target}, opts.Title, escapeWriter{out}, func() error {
+		fmt.Fprintf(out, "Creating snapshot..")
+		pp.Start()
+		defer pp.Stop()
+		return snapshotContainer(ctx, ui.client, container, opts, dbUser, dumpStopped,
+			func(err error) {
+				fellBack = true
+				pp.Stop()
+				showResult()
+				fmt.Fprintf(out, "[red]Failed to create snapshot[-]\n%s", err)
+				fmt.Fprintln(out)
+				fmt.Fprintf(out, "[yellow]Falling back to using a generic snapshot..")
+				pp.Start()
+			})
+	})
+	if !fellBack {
+		showResult()
+	}
 
 	if err == nil {
 		fmt.Fprintln(out, "[green]Successfully created snapshot![-]")
-		return
+	} else {
+		fmt.Fprintf(out, "[red]Failed to create snapshot[-]\n%s", err)
 	}
-	fmt.Fprintf(out, "[red]Failed to create snapshot[-]\n%s", err)
+}
 
-	// Don't try snapshotting again if we already tried the generic snapshot.
-	if _, ok := snapshotter.(*snapshot.Generic); ok {
-		return
+// createGroupSnapshot takes a group snapshot of all the containers in the
+// given container's docker-compose project, and displays the progress in out.
+func (ui *createUI) createGroupSnapshot(out *tview.TextView, container Container, opts snapshot.CreateOptions) {
+	ctx := context.Background()
+	svc, _ := getComposeService(container.ContainerJSON)
+	members, err := listProjectContainers(ctx, ui.client, svc.project)
+	if err == nil {
+		err = snapshotGroup(ctx, ui.client, members, opts, ui.config.Hooks, escapeWriter{out})
 	}
 
-	fmt.Fprintln(out)
-	fmt.Fprintf(out, "[yellow]Falling back to using a generic snapshot..")
-	pp.Start()
-	err = snapshot.NewGeneric(ui.client).Create(context.Background(), container.ContainerJSON, title, imageName)
-	pp.Stop()
+	out.Clear()
+	out.SetTextAlign(tview.AlignCenter)
 	if err == nil {
-		fmt.Fprintln(out, "[green]Successfully created snapshot![-]")
+		fmt.Fprintf(out, "[green]Successfully created snapshots of %d containers![-]\n", len(members))
 	} else {
-		fmt.Fprintf(out, "[red]Failed to create snapshot[-]\n%s", err)
+		fmt.Fprintf(out, "[red]Failed to create snapshot[-]\n%s", tview.Escape(err.Error()))
 	}
 }
 
+// snapshotContainer takes a snapshot of the given container. It attempts to
+// use the database aware snapshot implementation first, but falls back to a
+// generic snapshot if that fails. onFallback is called with the error from
+// the database aware snapshot before falling back.
+//
+// Stopped containers are only dumped if dumpStopped is set, since dumping
+// them requires booting a temporary copy of the database.
+func snapshotContainer(ctx context.Context, dockerClient *client.Client, container Container,
+	opts snapshot.CreateOptions, dbUser string, dumpStopped bool, onFallback func(error)) error {
+	_, err := snapshot.NewManager(dockerClient).Create(ctx, container.ID, snapshot.ManagerCreateOptions{
+		CreateOptions: opts,
+		SelectOptions: snapshot.SelectOptions{
+			DBUser:       dbUser,
+			DumpStopped:  dumpStopped,
+			ForceGeneric: forceGenericSnapshot,
+		},
+		OnFallback: onFallback,
+	})
+	return err
+}
+
 // Returns a new primitive which puts the provided primitive in the center and
 // sets its size to the given width and height.
 func newModal(p tview.Primitive, width, height int) tview.Primitive {
@@ -294,16 +456,3 @@ func center(p tview.Primitive, width, height int) tview.Primitive {
 			AddItem(tview.NewBox(), 0, 1, false), width, 1, false).
 		AddItem(tview.NewBox(), 0, 1, false)
 }
-
-func getEnv(vars []string, key string) (string, bool) {
-	for _, env := range vars {
-		envParts := strings.Split(env, "=")
-		if len(envParts) != 2 {
-			continue
-		}
-		if envParts[0] == key {
-			return envParts[1], true
-		}
-	}
-	return "", false
-}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// snapshotDetail is a single piece of metadata describing a snapshot.
+type snapshotDetail struct {
+	name  string
+	value string
+}
+
+// describeSnapshot returns the metadata of the given snapshot in a human
+// readable form. Empty values are omitted.
+func describeSnapshot(snap *snapshot.Snapshot) []snapshotDetail {
+	details := []snapshotDetail{
+		{"Title", snap.Title},
+		{"Description", snap.Description},
+		{"Tags", strings.Join(snap.Tags, ", ")},
+		{"Images", strings.Join(snap.ImageNames, ", ")},
+		{"Image ID", snap.ImageID},
+	}
+	if !snap.BaseImage {
+		details = append(details, snapshotDetail{"Created", snap.Created.Format(time.RFC1123)})
+		if snap.Pinned {
+			details = append(details, snapshotDetail{"Pinned", "yes"})
+		}
+	}
+
+	var mounts []string
+	for _, mount := range snap.Mounts {
+		desc := fmt.Sprintf("%s (%s)", mount.Destination, mount.Type)
+		if mount.Name != "" {
+			desc = fmt.Sprintf("%s (%s %s)", mount.Destination, mount.Type, mount.Name)
+		} else if mount.Source != "" {
+			desc = fmt.Sprintf("%s (%s %s)", mount.Destination, mount.Type, mount.Source)
+		}
+		mounts = append(mounts, desc)
+	}
+
+	details = append(details,
+		snapshotDetail{"Size", describeSize(snap.Size)},
+		snapshotDetail{"Snapshotter", snapshotterName(snap)},
+		snapshotDetail{"Consistency", string(snap.Consistency)},
+		snapshotDetail{"Engine Version", snap.EngineVersion},
+		snapshotDetail{"Dump Path", snap.DumpPath},
+		snapshotDetail{"Dump Checksum", snap.DumpChecksum},
+		snapshotDetail{"Mounts", strings.Join(mounts, ", ")},
+		snapshotDetail{"Excluded", strings.Join(snap.Exclude, ", ")},
+		snapshotDetail{"Source Volume", snap.Source.Volume},
+		snapshotDetail{"Source Container", snap.Source.ContainerName},
+		snapshotDetail{"Source Container ID", snap.Source.ContainerID},
+		snapshotDetail{"Compose Project", snap.Source.ComposeProject},
+		snapshotDetail{"Compose Service", snap.Source.ComposeService},
+		snapshotDetail{"Group", snap.GroupID},
+		snapshotDetail{"Schedule", snap.Schedule},
+		snapshotDetail{"Host", snap.Host},
+	)
+	if runConfig := snap.RunConfig; runConfig != nil {
+		var networks []string
+		for _, network := range runConfig.Networks {
+			networks = append(networks, network.Name)
+		}
+		details = append(details,
+			snapshotDetail{"Command", strings.Join(runConfig.Cmd, " ")},
+			snapshotDetail{"Ports", formatPorts(runConfig.Ports)},
+			snapshotDetail{"Networks", strings.Join(networks, ", ")},
+			snapshotDetail{"Restart Policy", runConfig.RestartPolicy},
+		)
+	}
+	if !snap.BaseImage {
+		details = append(details, snapshotDetail{"Schema Version", strconv.Itoa(snap.SchemaVersion)})
+	}
+
+	var nonEmpty []snapshotDetail
+	for _, detail := range details {
+		if detail.value != "" {
+			nonEmpty = append(nonEmpty, detail)
+		}
+	}
+	return nonEmpty
+}
+
+// describeSize returns a breakdown of the disk space used by a snapshot. It's
+// empty for base images.
+func describeSize(usage snapshot.DiskUsage) string {
+	if usage.Total() == 0 {
+		return ""
+	}
+
+	desc := formatSize(usage.Unique)
+	var parts []string
+	if usage.Dump != 0 {
+		parts = append(parts, "dump "+formatSize(usage.Dump))
+	}
+	if usage.Volumes != 0 {
+		parts = append(parts, "volumes "+formatSize(usage.Volumes))
+	}
+	if len(parts) != 0 {
+		desc += " (" + strings.Join(parts, ", ") + ")"
+	}
+	if usage.Shared != 0 {
+		desc += fmt.Sprintf(", %s shared with parent snapshots", formatSize(usage.Shared))
+	}
+	if usage.Base != 0 {
+		desc += fmt.Sprintf(", %s shared with the base image", formatSize(usage.Base))
+	}
+	return desc
+}
+
+// formatSize formats a size in bytes in a human readable form.
+func formatSize(size int64) string {
+	return units.HumanSize(float64(size))
+}
+
+// snapshotterName returns the name of the Snapshotter that created the
+// snapshot, and whether it was a fallback.
+func snapshotterName(snap *snapshot.Snapshot) string {
+	if snap.Fallback {
+		return snap.Snapshotter + " (fallback)"
+	}
+	return snap.Snapshotter
+}
+
+// sourceName returns a short description of the container or volume that the
+// snapshot was created from.
+func sourceName(snap *snapshot.Snapshot) string {
+	if snap.Source.Volume != "" {
+		return "volume " + snap.Source.Volume
+	}
+	if snap.Source.ComposeService != "" {
+		return snap.Source.ComposeProject + "/" + snap.Source.ComposeService
+	}
+	return snap.Source.ContainerName
+}
+
+// isVolumeSnapshot returns whether the snapshot was created from a volume
+// rather than a container.
+func isVolumeSnapshot(snap *snapshot.Snapshot) bool {
+	return snap.Snapshotter == "volume"
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// snapshotGroup takes a consistent snapshot of a group of containers, and
+// labels the snapshots with a shared group ID.
+//
+// Containers that will be snapshotted generically are frozen for the entire
+// group snapshot. They're stopped if the stop consistency mode is requested,
+// and paused otherwise. Database dumps can't be taken from frozen
+// containers, so the databases are dumped while the rest of the group is
+// frozen instead. This way, no writes are made to the databases by the rest
+// of the application while the group is being snapshotted.
+//
+// If any snapshot fails, the snapshots that were already created are
+// removed.
+//
+// The pre hooks of every container run before any of them are frozen, and
+// the post hooks run after they're all resumed.
+func snapshotGroup(ctx context.Context, dockerClient *client.Client, containers []Container,
+	opts snapshot.CreateOptions, hooks []hookConfig, out io.Writer) error {
+	if len(containers) == 0 {
+		return fmt.Errorf("no containers to snapshot")
+	}
+
+	var targets []hookTarget
+	for _, container := range containers {
+		targets = append(targets, hookTarget{
+			container: container,
+			hooks:     containerHooks(hooks, container),
+			imageName: groupMemberImageName(opts.ImageName, container),
+		})
+	}
+	return withHooks(ctx, dockerClient, targets, opts.Title, out, func() error {
+		return snapshotFrozenGroup(ctx, dockerClient, containers, opts, out)
+	})
+}
+
+// snapshotFrozenGroup freezes the containers, and snapshots them.
+func snapshotFrozenGroup(ctx context.Context, dockerClient *client.Client, containers []Container,
+	opts snapshot.CreateOptions, out io.Writer) (err error) {
+	opts.GroupID, err = newGroupID()
+	if err != nil {
+		return fmt.Errorf("generate group ID: %w", err)
+	}
+
+	genericOpts := opts
+	if genericOpts.Consistency != snapshot.ConsistencyStop {
+		genericOpts.Consistency = snapshot.ConsistencyPause
+	}
+
+	var frozen []Container
+	defer func() {
+		// Resume the containers even if the snapshot was cancelled.
+		ctx, cancel := snapshot.CleanupContext()
+		defer cancel()
+		for _, container := range frozen {
+			var resumeErr error
+			if genericOpts.Consistency == snapshot.ConsistencyStop {
+				fmt.Fprintf(out, "Restarting %s..\n", containerName(container))
+				resumeErr = dockerClient.ContainerStart(ctx, container.ID, types.ContainerStartOptions{})
+			} else {
+				resumeErr = dockerClient.ContainerUnpause(ctx, container.ID)
+			}
+			if resumeErr != nil && err == nil {
+				err = fmt.Errorf("resume %s: %w", containerName(container), resumeErr)
+			}
+		}
+	}()
+
+	var databases, generic []Container
+	for _, container := range containers {
+		snapshotter := snapshot.NewSnapshotter(dockerClient, container.ContainerJSON, container.Databases,
+			snapshot.SelectOptions{ForceGeneric: forceGenericSnapshot})
+		if _, ok := snapshotter.(*snapshot.Generic); !ok {
+			databases = append(databases, container)
+			continue
+		}
+
+		generic = append(generic, container)
+		if container.State == nil || !container.State.Running || container.State.Paused {
+			continue
+		}
+
+		if genericOpts.Consistency == snapshot.ConsistencyStop {
+			if err := snapshot.CheckConsistency(container.ContainerJSON, genericOpts.Consistency); err != nil {
+				return fmt.Errorf("freeze %s: %w", containerName(container), err)
+			}
+			fmt.Fprintf(out, "Stopping %s..\n", containerName(container))
+			err = dockerClient.ContainerStop(ctx, container.ID, nil)
+		} else {
+			fmt.Fprintf(out, "Pausing %s..\n", containerName(container))
+			err = dockerClient.ContainerPause(ctx, container.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("freeze %s: %w", containerName(container), err)
+		}
+		frozen = append(frozen, container)
+	}
+
+	var created []string
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, image := range created {
+			dockerClient.ImageRemove(ctx, image, types.ImageRemoveOptions{})
+		}
+	}()
+
+	snapshotMember := func(container Container, memberOpts snapshot.CreateOptions) error {
+		memberOpts.ImageName = groupMemberImageName(opts.ImageName, container)
+
+		fmt.Fprintf(out, "Snapshotting %s..\n", containerName(container))
+		err := snapshotContainer(ctx, dockerClient, container, memberOpts, "", false,
+			func(err error) {
+				fmt.Fprintf(out, "Failed to create database aware snapshot of %s, "+
+					"falling back to a generic snapshot: %s\n", containerName(container), err)
+			})
+		if err != nil {
+			return fmt.Errorf("snapshot %s: %w", containerName(container), err)
+		}
+		created = append(created, memberOpts.ImageName)
+		return nil
+	}
+
+	for _, container := range databases {
+		if err := snapshotMember(container, opts); err != nil {
+			return err
+		}
+	}
+	for _, container := range generic {
+		if err := snapshotMember(container, genericOpts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listProjectContainers returns the containers that belong to the given
+// docker-compose project.
+func listProjectContainers(ctx context.Context, dockerClient *client.Client, project string) ([]Container, error) {
+	containers, err := listContainers(ctx, dockerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	var inProject []Container
+	for _, container := range containers {
+		if svc, ok := getComposeService(container.ContainerJSON); ok && svc.project == project {
+			inProject = append(inProject, container)
+		}
+	}
+	return inProject, nil
+}
+
+// findGroupContainers returns the container that each snapshot in the group
+// was created from.
+func findGroupContainers(ctx context.Context, dockerClient *client.Client, group []*snapshot.Snapshot) (
+	map[*snapshot.Snapshot]Container, error) {
+	containers, err := listContainers(ctx, dockerClient)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := map[*snapshot.Snapshot]Container{}
+	for _, snap := range group {
+		var match *Container
+		for i, container := range containers {
+			if containerName(container) == snap.Source.ContainerName {
+				match = &containers[i]
+				break
+			}
+
+			// Fall back to matching by the docker-compose service in case the
+			// container was recreated with a different name.
+			svc, ok := getComposeService(container.ContainerJSON)
+			if ok && snap.Source.ComposeService != "" &&
+				svc.project == snap.Source.ComposeProject && svc.service == snap.Source.ComposeService {
+				match = &containers[i]
+			}
+		}
+
+		if match == nil {
+			return nil, fmt.Errorf("no container for %s", snap.Source.ContainerName)
+		}
+		matches[snap] = *match
+	}
+	return matches, nil
+}
+
+// groupMembers returns the snapshots that were taken together with snap.
+func groupMembers(snapshots []*snapshot.Snapshot, snap *snapshot.Snapshot) []*snapshot.Snapshot {
+	if snap.GroupID == "" {
+		return []*snapshot.Snapshot{snap}
+	}
+
+	var members []*snapshot.Snapshot
+	for _, other := range snapshots {
+		if other.GroupID == snap.GroupID {
+			members = append(members, other)
+		}
+	}
+	return members
+}
+
+// groupMemberImageName returns the image name for a container's snapshot
+// within a group snapshot.
+func groupMemberImageName(imageName string, container Container) string {
+	member := containerName(container)
+	if svc, ok := getComposeService(container.ContainerJSON); ok && svc.service != "" {
+		member = svc.service
+	}
+
+	// Keep the tag at the end of the image name.
+	tag := ""
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		imageName, tag = imageName[:i], imageName[i:]
+	}
+	return imageName + "-" + snapshot.ImageNameForTitle(member) + tag
+}
+
+func containerName(container Container) string {
+	return strings.TrimPrefix(container.Name, "/")
+}
+
+func newGroupID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
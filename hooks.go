@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// containerHooks returns the hooks that run when the container is
+// snapshotted: the hooks configured for its image, followed by the hooks in
+// its labels.
+func containerHooks(configs []hookConfig, container Container) []snapshot.Hook {
+	var hooks []snapshot.Hook
+	for _, config := range configs {
+		if container.Config == nil || !matchesImage(config.Image, container.Config.Image) {
+			continue
+		}
+		for _, hook := range config.Pre {
+			hooks = append(hooks, snapshot.Hook{Stage: snapshot.HookPre, Command: hook.Command, Host: hook.Host})
+		}
+		for _, hook := range config.Post {
+			hooks = append(hooks, snapshot.Hook{Stage: snapshot.HookPost, Command: hook.Command, Host: hook.Host})
+		}
+	}
+
+	if container.Config != nil {
+		hooks = append(hooks, snapshot.LabelHooks(container.Config.Labels)...)
+	}
+	return hooks
+}
+
+// matchesImage returns whether the glob pattern matches the image that a
+// container was created from. Patterns without a tag match every tag of the
+// image, and the docker.io/library/ prefix of official images is optional.
+func matchesImage(pattern, image string) bool {
+	pattern = normalizeImage(pattern)
+	image = normalizeImage(image)
+	if match, _ := filepath.Match(pattern, image); match {
+		return true
+	}
+
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	match, _ := filepath.Match(pattern, image)
+	return match
+}
+
+func normalizeImage(image string) string {
+	image = strings.TrimPrefix(image, "docker.io/")
+	return strings.TrimPrefix(image, "library/")
+}
+
+// hookTarget is a container whose hooks run around a snapshot.
+type hookTarget struct {
+	container Container
+	hooks     []snapshot.Hook
+
+	// imageName is the image name of the container's snapshot.
+	imageName string
+}
+
+// withHooks runs the pre hooks of the targets, takes the snapshot, and then
+// runs the post hooks of the targets. If a pre hook fails, the snapshot
+// isn't taken. The post hooks of every target whose pre hooks succeeded are
+// run even if the snapshot fails, so that they can undo the pre hooks.
+//
+// Each hook is a separate process that exits before the snapshot is taken,
+// so hooks can't hold state that's tied to a session. For example, running
+// `FLUSH TABLES WITH READ LOCK` in a MySQL pre hook has no effect, since the
+// lock is released as soon as the exec'd client disconnects.
+func withHooks(ctx context.Context, dockerClient *client.Client, targets []hookTarget, title string,
+	out io.Writer, takeSnapshot func() error) error {
+	runStage := func(target hookTarget, stage snapshot.HookStage, env []string) error {
+		name := containerName(target.container)
+		env = append(env,
+			"DKSNAP_HOOK="+string(stage),
+			"DKSNAP_CONTAINER="+name,
+			"DKSNAP_TITLE="+title,
+			"DKSNAP_IMAGE="+target.imageName)
+		for _, hook := range target.hooks {
+			if hook.Stage != stage {
+				continue
+			}
+
+			// Commands can't be executed in stopped or paused containers.
+			if !hook.Host && (!isRunning(target.container) || target.container.State.Paused) {
+				fmt.Fprintf(out, "Skipping %s hook %q since %s isn't running\n", stage, hook.Command, name)
+				continue
+			}
+
+			fmt.Fprintf(out, "Running %s hook %q for %s..\n", stage, hook.Command, name)
+			if err := snapshot.RunHook(ctx, dockerClient, target.container.ContainerJSON, hook, env, out); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	var err error
+	var prepared []hookTarget
+	for _, target := range targets {
+		if err = runStage(target, snapshot.HookPre, nil); err != nil {
+			err = fmt.Errorf("aborted snapshot: %w", err)
+			break
+		}
+		prepared = append(prepared, target)
+	}
+
+	if err == nil {
+		err = takeSnapshot()
+	}
+
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	for _, target := range prepared {
+		postErr := runStage(target, snapshot.HookPost, []string{"DKSNAP_STATUS=" + status})
+		if postErr != nil && err == nil {
+			err = fmt.Errorf("created snapshot, but a post hook failed: %w", postErr)
+		}
+	}
+	return err
+}
@@ -4,12 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-units"
 	"github.com/gdamore/tcell"
@@ -22,6 +20,7 @@ const buttonColor = tcell.ColorDarkCyan
 
 type infoUI struct {
 	client           *client.Client
+	manager          *snapshot.Manager
 	snapshots        []*snapshot.Snapshot
 	selectedSnapshot *snapshot.Snapshot
 
@@ -34,6 +33,7 @@ type infoUI struct {
 func newInfoUI(dockerClient *client.Client, app *tview.Application) *infoUI {
 	ui := &infoUI{
 		client:              dockerClient,
+		manager:             snapshot.NewManager(dockerClient),
 		snapshotListView:    tview.NewTable(),
 		snapshotActionsView: tview.NewFlex(),
 		Pages:               tview.NewPages(),
@@ -75,6 +75,9 @@ const (
 	snapshotNameColumnIndex = iota
 	snapshotImageColumnIndex
 	snapshotCreatedColumnIndex
+	snapshotSourceColumnIndex
+	snapshotTypeColumnIndex
+	snapshotSizeColumnIndex
 )
 
 func (ui *infoUI) renderSnapshotList() {
@@ -104,15 +107,40 @@ func (ui *infoUI) renderSnapshotList() {
 		Expansion:     1,
 		NotSelectable: true,
 	})
+	ui.snapshotListView.SetCell(0, snapshotSourceColumnIndex, &tview.TableCell{
+		Text:          "SOURCE",
+		Color:         tcell.ColorYellow,
+		Expansion:     1,
+		NotSelectable: true,
+	})
+	ui.snapshotListView.SetCell(0, snapshotTypeColumnIndex, &tview.TableCell{
+		Text:          "TYPE",
+		Color:         tcell.ColorYellow,
+		Expansion:     1,
+		NotSelectable: true,
+	})
+	ui.snapshotListView.SetCell(0, snapshotSizeColumnIndex, &tview.TableCell{
+		Text:          "SIZE",
+		Color:         tcell.ColorYellow,
+		Expansion:     1,
+		NotSelectable: true,
+	})
 
 	// Populate each row of the table with the container information.
 	for idx, snapshot := range ui.snapshots {
 		// Skip the column names in the first row.
 		row := idx + 1
 		ui.snapshotListView.SetCellSimple(row, snapshotImageColumnIndex, strings.Join(snapshot.ImageNames, ", "))
-		ui.snapshotListView.SetCellSimple(row, snapshotNameColumnIndex, snapshot.Title)
+		nameCell := tview.NewTableCell(snapshotNodeName(snapshot))
+		if snapshot.Pinned {
+			nameCell.SetTextColor(pinnedColor)
+		}
+		ui.snapshotListView.SetCell(row, snapshotNameColumnIndex, nameCell)
 		ui.snapshotListView.SetCellSimple(row, snapshotCreatedColumnIndex, units.HumanDuration(
 			time.Since(snapshot.Created))+" ago")
+		ui.snapshotListView.SetCellSimple(row, snapshotSourceColumnIndex, sourceName(snapshot))
+		ui.snapshotListView.SetCellSimple(row, snapshotTypeColumnIndex, snapshotterName(snapshot))
+		ui.snapshotListView.SetCellSimple(row, snapshotSizeColumnIndex, formatSize(snapshot.Size.Unique))
 	}
 	ui.app.Draw()
 }
@@ -134,7 +162,7 @@ func (ui *infoUI) popupHistory(snap *snapshot.Snapshot) {
 		root = root.Parent
 	}
 
-	rootNode := tview.NewTreeNode(snapshotNodeName(root)).SetReference(root)
+	rootNode := newSnapshotNode(root)
 	treeView.SetRoot(rootNode)
 	addChildren(rootNode, root.Children)
 
@@ -175,50 +203,193 @@ func (ui *infoUI) popupHistory(snap *snapshot.Snapshot) {
 	ui.app.SetFocus(historyView)
 }
 
-func (ui *infoUI) popupReplaceContainer(snap *snapshot.Snapshot) {
-	selectedFunc := func(container Container) {
-		logs := tview.NewTextView().
-			SetDynamicColors(true).
-			SetChangedFunc(func() {
-				ui.app.Draw()
+func (ui *infoUI) popupDetails(snap *snapshot.Snapshot) {
+	detailsView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	detailsView.SetBorder(true).SetTitle("Snapshot Details")
+	for _, detail := range describeSnapshot(snap) {
+		fmt.Fprintf(detailsView, "[yellow]%s:[-] %s\n", detail.name, tview.Escape(detail.value))
+	}
+
+	detailsView.SetDoneFunc(func(_ tcell.Key) {
+		ui.Pages.RemovePage("snapshot-details")
+		ui.app.SetFocus(ui.snapshotActionsView)
+	})
+
+	_, _, screenWidth, _ := ui.Pages.GetRect()
+	ui.Pages.AddPage("snapshot-details", newModal(detailsView, screenWidth-10, 16), true, true)
+	ui.app.SetFocus(detailsView)
+}
+
+func (ui *infoUI) popupEdit(snap *snapshot.Snapshot) {
+	form := tview.NewForm()
+	form.SetBorder(true).
+		SetTitle("Edit Snapshot")
+
+	form.
+		AddInputField("Title", snap.Title, 30, nil, nil).
+		AddInputField("Description", snap.Description, 30, nil, nil).
+		AddInputField("Tags", strings.Join(snap.Tags, ", "), 30, nil, nil).
+		AddCheckbox("Pinned", snap.Pinned, nil).
+		AddButton("Save", func() {
+			opts := snapshot.EditOptions{
+				Title:       form.GetFormItemByLabel("Title").(*tview.InputField).GetText(),
+				Description: form.GetFormItemByLabel("Description").(*tview.InputField).GetText(),
+				Tags:        parseTags(form.GetFormItemByLabel("Tags").(*tview.InputField).GetText()),
+				Pinned:      form.GetFormItemByLabel("Pinned").(*tview.Checkbox).IsChecked(),
+			}
+			if opts.Title == "" {
+				alert(ui.app, ui.Pages, "A title is required.", form)
+				return
+			}
+
+			ui.Pages.RemovePage("edit-snapshot-form")
+			if err := ui.manager.Edit(context.Background(), snap, opts); err != nil {
+				alert(ui.app, ui.Pages, fmt.Sprintf("Failed to edit snapshot: %s", err), ui.snapshotListView)
+			} else {
+				alert(ui.app, ui.Pages, "Successfully edited snapshot", ui.snapshotListView)
+			}
+		})
+
+	fields := []formField{
+		form.GetFormItemByLabel("Title").(formField),
+		form.GetFormItemByLabel("Description").(formField),
+		form.GetFormItemByLabel("Tags").(formField),
+		form.GetFormItemByLabel("Pinned").(formField),
+	}
+	setupFormNavigation(ui.app, fields, form.GetButton(form.GetButtonIndex("Save")))
+
+	ui.Pages.AddPage("edit-snapshot-form", newModal(form, 50, 13), true, true)
+	ui.app.SetFocus(form)
+	form.SetCancelFunc(func() {
+		ui.Pages.RemovePage("edit-snapshot-form")
+		ui.app.SetFocus(ui.snapshotActionsView)
+	})
+}
+
+// popupBoot lets the user override the name and ports of the container
+// booted from the snapshot, for example to avoid conflicts with the container
+// that the snapshot was created from.
+func (ui *infoUI) popupBoot(snap *snapshot.Snapshot) {
+	form := tview.NewForm()
+	form.SetBorder(true).
+		SetTitle("Boot New Container")
+
+	form.
+		AddInputField("Container Name", "", 30, nil, nil).
+		AddInputField("Ports", formatPorts(snap.RunConfig.Ports), 30, nil, nil).
+		AddButton("Boot", func() {
+			ports, err := parsePorts(form.GetFormItemByLabel("Ports").(*tview.InputField).GetText())
+			if err != nil {
+				alert(ui.app, ui.Pages, err.Error(), form)
+				return
+			}
+
+			ui.Pages.RemovePage("boot-form")
+			ui.bootSnapshot(snap, snapshot.BootOptions{
+				Name:  form.GetFormItemByLabel("Container Name").(*tview.InputField).GetText(),
+				Ports: ports,
 			})
+		})
 
-		modalContents := tview.NewFlex().
-			SetDirection(tview.FlexRow).
-			AddItem(logs, 0, 3, false)
-		modalContents.
-			SetBorder(true).
-			SetTitle("Boot Status")
+	fields := []formField{
+		form.GetFormItemByLabel("Container Name").(formField),
+		form.GetFormItemByLabel("Ports").(formField),
+	}
+	setupFormNavigation(ui.app, fields, form.GetButton(form.GetButtonIndex("Boot")))
 
-		modal := newModal(modalContents, 60, 10)
-		ui.Pages.AddPage("replace-status", modal, true, true)
+	ui.Pages.AddPage("boot-form", newModal(form, 50, 9), true, true)
+	ui.app.SetFocus(form)
+	form.SetCancelFunc(func() {
+		ui.Pages.RemovePage("boot-form")
+		ui.app.SetFocus(ui.snapshotActionsView)
+	})
+}
 
-		fmt.Fprintf(logs, "Replacing container..")
-		pp := NewProgressPrinter(logs)
-		pp.Start()
+func (ui *infoUI) bootSnapshot(snap *snapshot.Snapshot, opts snapshot.BootOptions) {
+	ui.showBootStatus("Booting snapshot..",
+		func(logs io.Writer) (string, error) {
+			result, err := ui.manager.Boot(context.Background(), snap, opts, logs)
+			return strings.Join(result.Notices, "\n"), err
+		},
+		"Successfully booted snapshot!", "Failed to boot snapshot",
+		func() {
+			ui.app.SetFocus(ui.snapshotActionsView)
+		})
+}
 
-		go func() {
-			err := ui.replaceContainer(context.Background(), container, snap)
-			ui.app.QueueUpdateDraw(func() {
-				pp.Stop()
-				logs.Clear()
-				logs.SetTextAlign(tview.AlignCenter)
+// showBootStatus runs a task that boots a container, and displays the logs
+// written by the task in a modal. Once the task completes, the modal shows the
+// result along with any notice returned by the task, and onClose is called
+// when the user dismisses it.
+func (ui *infoUI) showBootStatus(description string, task func(logs io.Writer) (string, error),
+	successMessage, failureMessage string, onClose func()) {
+	logs := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetChangedFunc(func() {
+			ui.app.Draw()
+		})
 
-				message := "[green]Successfully replaced container![-]"
-				if err != nil {
-					message = fmt.Sprintf("[red]Failed to replace container:[-]\n%s", err)
-				}
-				fmt.Fprintln(logs, message)
+	modalContents := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(logs, 0, 3, false)
+	modalContents.
+		SetBorder(true).
+		SetTitle("Boot Status")
+
+	modal := newModal(modalContents, 80, 20)
+	ui.Pages.AddPage("boot-status", modal, true, true)
+	fmt.Fprintln(logs, description)
+
+	go func() {
+		notice, err := task(escapeWriter{logs})
+		ui.app.QueueUpdateDraw(func() {
+			logs.Clear()
+			logs.SetTextAlign(tview.AlignCenter)
+
+			message := fmt.Sprintf("[green]%s[-]", successMessage)
+			if notice != "" {
+				message += "\n" + tview.Escape(notice)
+			}
+			if err != nil {
+				message = fmt.Sprintf("[red]%s:[-]\n%s", failureMessage, tview.Escape(err.Error()))
+			}
+			fmt.Fprintln(logs, message)
 
-				exitButton := tview.NewButton("OK").SetSelectedFunc(func() {
-					ui.Pages.RemovePage("replace-status")
+			exitButton := tview.NewButton("OK").SetSelectedFunc(func() {
+				ui.Pages.RemovePage("boot-status")
+				onClose()
+			})
+			modalContents.AddItem(center(exitButton, 4, 1), 0, 1, true)
+			ui.app.SetFocus(exitButton)
+		})
+	}()
+}
+
+func (ui *infoUI) popupReplaceContainer(snap *snapshot.Snapshot) {
+	selectedFunc := func(container Container) {
+		replace := func() {
+			ui.showBootStatus("Replacing container..",
+				func(logs io.Writer) (string, error) {
+					if err := ui.manager.Replace(context.Background(), container.ID, snap, logs); err != nil {
+						return "", err
+					}
+					return pinComposeService(container, snap), nil
+				},
+				"Successfully replaced container!", "Failed to replace container",
+				func() {
 					ui.Pages.RemovePage("replace-container-modal")
 					ui.app.SetFocus(ui.snapshotListView)
 				})
-				modalContents.AddItem(center(exitButton, 4, 1), 0, 1, true)
-				ui.app.SetFocus(exitButton)
-			})
-		}()
+		}
+
+		if paths := overwrittenBindPaths(snap, container); len(paths) != 0 {
+			confirm(ui.app, ui.Pages, overwriteWarning(paths), replace, ui.app.GetFocus())
+			return
+		}
+		replace()
 	}
 	doneFunc := func(_ tcell.Key) {
 		ui.Pages.RemovePage("replace-container-modal")
@@ -236,36 +407,155 @@ func (ui *infoUI) popupReplaceContainer(snap *snapshot.Snapshot) {
 	ui.app.SetFocus(containerSelector)
 }
 
-func (ui *infoUI) replaceContainer(ctx context.Context, old Container, snap *snapshot.Snapshot) error {
-	err := ui.client.ContainerRemove(ctx, old.ID, types.ContainerRemoveOptions{
-		Force: true,
+// popupRestoreVolume asks the user which volume to restore the volume
+// snapshot into.
+func (ui *infoUI) popupRestoreVolume(snap *snapshot.Snapshot) {
+	form := tview.NewForm()
+	form.SetBorder(true).
+		SetTitle("Restore Volume")
+
+	form.
+		AddInputField("Volume Name", snap.Source.Volume, 30, nil, nil).
+		AddButton("Restore", func() {
+			volume := form.GetFormItemByLabel("Volume Name").(*tview.InputField).GetText()
+			if volume == "" {
+				alert(ui.app, ui.Pages, "A volume name is required.", form)
+				return
+			}
+
+			ui.Pages.RemovePage("restore-volume-form")
+			ui.showBootStatus(fmt.Sprintf("Restoring %s..", volume),
+				func(_ io.Writer) (string, error) {
+					return "", ui.manager.RestoreVolume(context.Background(), snap, volume)
+				},
+				"Successfully restored volume!", "Failed to restore volume",
+				func() {
+					ui.app.SetFocus(ui.snapshotActionsView)
+				})
+		})
+
+	fields := []formField{
+		form.GetFormItemByLabel("Volume Name").(formField),
+	}
+	setupFormNavigation(ui.app, fields, form.GetButton(form.GetButtonIndex("Restore")))
+
+	ui.Pages.AddPage("restore-volume-form", newModal(form, 50, 7), true, true)
+	ui.app.SetFocus(form)
+	form.SetCancelFunc(func() {
+		ui.Pages.RemovePage("restore-volume-form")
+		ui.app.SetFocus(ui.snapshotActionsView)
 	})
-	if err != nil {
-		return fmt.Errorf("remove old container: %w", err)
+}
+
+// popupResetContainer lets the user pick a container booted from a snapshot,
+// and restores the snapshot's data in it.
+func (ui *infoUI) popupResetContainer() {
+	selectedFunc := func(container Container) {
+		reset := func() {
+			ui.showBootStatus("Resetting container..",
+				func(logs io.Writer) (string, error) {
+					ctx, cancel := context.WithTimeout(context.Background(), snapshot.ReadyTimeout)
+					defer cancel()
+					return "", ui.manager.Reset(ctx, container.ID, logs)
+				},
+				"Successfully reset container!", "Failed to reset container",
+				func() {
+					ui.Pages.RemovePage("reset-container-modal")
+					ui.app.SetFocus(ui.snapshotListView)
+				})
+		}
+
+		if container.FromSnapshot != nil {
+			if paths := overwrittenBindPaths(container.FromSnapshot, container); len(paths) != 0 {
+				confirm(ui.app, ui.Pages, overwriteWarning(paths), reset, ui.app.GetFocus())
+				return
+			}
+		}
+		reset()
+	}
+	doneFunc := func(_ tcell.Key) {
+		ui.Pages.RemovePage("reset-container-modal")
 	}
 
-	containerConfig := old.Config
-	containerConfig.Image = snap.ImageID
-	if len(snap.ImageNames) > 0 {
-		containerConfig.Image = snap.ImageNames[0]
+	containerSelector := NewContainerSelector(ui.client, selectedFunc, doneFunc)
+	if err := containerSelector.Sync(context.Background()); err != nil {
+		alert(ui.app, ui.Pages, fmt.Sprintf("Failed to list containers: %s", err), ui.snapshotActionsView)
+		return
 	}
 
-	// Force the container to use the snapshot's entrypoint.
-	containerConfig.Entrypoint = nil
+	_, _, screenWidth, screenHeight := ui.Pages.GetRect()
+	modal := newModal(containerSelector, screenWidth-10, screenHeight-10)
+	ui.Pages.AddAndSwitchToPage("reset-container-modal", modal, true)
+	ui.app.SetFocus(containerSelector)
+}
+
+// popupReplaceGroup asks the user whether to replace all the containers in
+// the snapshot's group, or just a single container.
+func (ui *infoUI) popupReplaceGroup(snap *snapshot.Snapshot, group []*snapshot.Snapshot) {
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("This snapshot was taken together with %d other containers. "+
+			"Replace all of them, or pick a single container to replace?", len(group)-1)).
+		AddButtons([]string{"Replace Group", "Pick Container", "Cancel"}).
+		SetDoneFunc(func(_ int, label string) {
+			ui.Pages.RemovePage("replace-group-modal")
+			switch label {
+			case "Replace Group":
+				containers, err := findGroupContainers(context.Background(), ui.client, group)
+				if err != nil {
+					alert(ui.app, ui.Pages, fmt.Sprintf("Failed to find the group's containers: %s", err),
+						ui.snapshotActionsView)
+					return
+				}
+
+				replace := func() {
+					ui.showBootStatus("Replacing group..",
+						func(logs io.Writer) (string, error) {
+							return ui.replaceGroup(context.Background(), group, containers, logs)
+						},
+						"Successfully replaced group!", "Failed to replace group",
+						func() {
+							ui.app.SetFocus(ui.snapshotListView)
+						})
+				}
+
+				var paths []string
+				for _, snap := range group {
+					paths = append(paths, overwrittenBindPaths(snap, containers[snap])...)
+				}
+				if len(paths) != 0 {
+					confirm(ui.app, ui.Pages, overwriteWarning(paths), replace, ui.snapshotActionsView)
+					return
+				}
+				replace()
+			case "Pick Container":
+				ui.popupReplaceContainer(snap)
+			default:
+				ui.app.SetFocus(ui.snapshotActionsView)
+			}
+		})
+	ui.Pages.AddPage("replace-group-modal", modal, true, true)
+	ui.app.SetFocus(modal)
+}
 
-	networkingConfig := &network.NetworkingConfig{
-		EndpointsConfig: old.NetworkSettings.Networks,
+// replaceGroup replaces every container in the group, and pins the
+// docker-compose services to their snapshots.
+func (ui *infoUI) replaceGroup(ctx context.Context, group []*snapshot.Snapshot,
+	containers map[*snapshot.Snapshot]Container, logs io.Writer) (string, error) {
+	containerIDs := map[*snapshot.Snapshot]string{}
+	for snap, container := range containers {
+		containerIDs[snap] = container.ID
 	}
-	createdContainer, err := ui.client.ContainerCreate(ctx, containerConfig, old.HostConfig, networkingConfig, old.Name)
-	if err != nil {
-		return fmt.Errorf("create new container: %w", err)
+	if err := ui.manager.ReplaceGroup(ctx, group, containerIDs, logs); err != nil {
+		return "", err
 	}
 
-	err = ui.client.ContainerStart(ctx, createdContainer.ID, types.ContainerStartOptions{})
-	if err != nil {
-		return fmt.Errorf("start new container: %w", err)
+	var notices []string
+	for _, snap := range group {
+		if notice := pinComposeService(containers[snap], snap); notice != "" {
+			notices = append(notices, notice)
+		}
 	}
-	return nil
+	return strings.Join(notices, "\n"), nil
 }
 
 func (ui *infoUI) renderDiff(diffView *tview.TextView, oldSnap, newSnap *snapshot.Snapshot) {
@@ -285,7 +575,7 @@ func (ui *infoUI) renderDiff(diffView *tview.TextView, oldSnap, newSnap *snapsho
 	pp.Start()
 
 	go func() {
-		diff, err := snapshot.Diff(context.Background(), ui.client, oldSnap, newSnap)
+		diff, err := ui.manager.Diff(context.Background(), oldSnap, newSnap)
 		pp.Stop()
 		if err != nil {
 			diffView.SetText(fmt.Sprintf("Failed to diff: %s", err))
@@ -310,34 +600,87 @@ func (ui *infoUI) setupSnapshotActions() {
 			ui.popupHistory(ui.selectedSnapshot)
 		})
 
+	detailsButton := tview.NewButton("View Details").
+		SetSelectedFunc(func() {
+			ui.popupDetails(ui.selectedSnapshot)
+		})
+
+	editButton := tview.NewButton("Edit Snapshot").
+		SetSelectedFunc(func() {
+			ui.popupEdit(ui.selectedSnapshot)
+		})
+
 	bootButton := tview.NewButton("Boot New Container").
 		SetSelectedFunc(func() {
-			if err := ui.bootSnapshot(context.Background(), ui.selectedSnapshot); err != nil {
-				alert(ui.app, ui.Pages, fmt.Sprintf("Failed to boot snapshot: %s", err), ui.snapshotActionsView)
-			} else {
-				alert(ui.app, ui.Pages, "Successfully booted snapshot", ui.snapshotActionsView)
+			snap := ui.selectedSnapshot
+			if isVolumeSnapshot(snap) {
+				alert(ui.app, ui.Pages, "Volume snapshots can't be booted. "+
+					"Use Restore Volume instead.", ui.snapshotActionsView)
+				return
 			}
+			if snap.RunConfig != nil {
+				ui.popupBoot(snap)
+				return
+			}
+			ui.bootSnapshot(snap, snapshot.BootOptions{})
 		})
 
 	replaceButton := tview.NewButton("Replace Running Container").
 		SetSelectedFunc(func() {
-			ui.popupReplaceContainer(ui.selectedSnapshot)
+			snap := ui.selectedSnapshot
+			if isVolumeSnapshot(snap) {
+				alert(ui.app, ui.Pages, "Volume snapshots can't replace containers. "+
+					"Use Restore Volume instead.", ui.snapshotActionsView)
+				return
+			}
+			if group := groupMembers(ui.snapshots, snap); len(group) > 1 {
+				ui.popupReplaceGroup(snap, group)
+				return
+			}
+			ui.popupReplaceContainer(snap)
+		})
+
+	resetButton := tview.NewButton("Reset Container").
+		SetSelectedFunc(func() {
+			ui.popupResetContainer()
+		})
+
+	restoreVolumeButton := tview.NewButton("Restore Volume").
+		SetSelectedFunc(func() {
+			snap := ui.selectedSnapshot
+			if !isVolumeSnapshot(snap) {
+				alert(ui.app, ui.Pages, "Only volume snapshots can be restored into volumes.",
+					ui.snapshotActionsView)
+				return
+			}
+			ui.popupRestoreVolume(snap)
 		})
 
 	deleteButton := tview.NewButton("Delete Snapshot").
 		SetSelectedFunc(func() {
-			for _, name := range ui.selectedSnapshot.ImageNames {
-				_, err := ui.client.ImageRemove(context.Background(), name, types.ImageRemoveOptions{Force: true})
+			snap := ui.selectedSnapshot
+			// Only force the removal once the user has confirmed it, so that
+			// Docker refuses to remove snapshots used by containers.
+			remove := func(force bool) {
+				err := ui.manager.Delete(context.Background(), snap, force)
 				if err != nil {
 					alert(ui.app, ui.Pages, fmt.Sprintf("Failed to delete snapshot: %s", err), ui.snapshotActionsView)
 				} else {
 					alert(ui.app, ui.Pages, "Successfully deleted snapshot", ui.snapshotActionsView)
 				}
 			}
+
+			if snap.Pinned {
+				confirm(ui.app, ui.Pages, fmt.Sprintf("%q is pinned. Delete it anyway?", snap.Title),
+					func() { remove(true) }, ui.snapshotActionsView)
+				return
+			}
+			remove(false)
 		})
 
 	buttons := []*tview.Button{
-		historyButton, bootButton, replaceButton, deleteButton,
+		historyButton, detailsButton, editButton, bootButton, replaceButton, resetButton,
+		restoreVolumeButton, deleteButton,
 	}
 	for i, button := range buttons {
 		i := i
@@ -378,27 +721,8 @@ func (ui *infoUI) setupSnapshotActions() {
 	ui.app.Draw()
 }
 
-func (ui *infoUI) bootSnapshot(ctx context.Context, snap *snapshot.Snapshot) error {
-	image := snap.ImageID
-	if len(snap.ImageNames) > 0 {
-		image = snap.ImageNames[0]
-	}
-
-	containerSpec := &container.Config{Image: image}
-	containerID, err := ui.client.ContainerCreate(ctx, containerSpec, nil, nil, "")
-	if err != nil {
-		return fmt.Errorf("create container: %w", err)
-	}
-
-	err = ui.client.ContainerStart(ctx, containerID.ID, types.ContainerStartOptions{})
-	if err != nil {
-		return fmt.Errorf("start container: %w", err)
-	}
-	return nil
-}
-
 func (ui *infoUI) syncSnapshots(ctx context.Context) error {
-	snapshots, err := snapshot.List(ctx, ui.client)
+	snapshots, err := ui.manager.List(ctx)
 	if err != nil {
 		return fmt.Errorf("list snapshots: %w", err)
 	}
@@ -410,12 +734,25 @@ func (ui *infoUI) syncSnapshots(ctx context.Context) error {
 
 func addChildren(parent *tview.TreeNode, children []*snapshot.Snapshot) {
 	for _, child := range children {
-		childNode := tview.NewTreeNode(snapshotNodeName(child)).SetReference(child)
+		childNode := newSnapshotNode(child)
 		parent.AddChild(childNode)
 		addChildren(childNode, child.Children)
 	}
 }
 
+// escapeWriter escapes tview color tags in the text written to it so that
+// arbitrary output can be displayed in a TextView.
+type escapeWriter struct {
+	out io.Writer
+}
+
+func (w escapeWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, tview.Escape(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 func colorizeDiff(toColorize string) string {
 	var colorized bytes.Buffer
 	for _, line := range strings.SplitAfter(toColorize, "\n") {
@@ -431,8 +768,35 @@ func colorizeDiff(toColorize string) string {
 	return colorized.String()
 }
 
+// parseTags parses a comma separated list of tags.
+func parseTags(tagsStr string) []string {
+	var tags []string
+	for _, tag := range strings.Split(tagsStr, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// pinnedColor highlights pinned snapshots in the snapshot list and history
+// tree. It must differ from the green used for the selected snapshot in the
+// history tree.
+const pinnedColor = tcell.ColorFuchsia
+
+func newSnapshotNode(snap *snapshot.Snapshot) *tview.TreeNode {
+	node := tview.NewTreeNode(snapshotNodeName(snap)).SetReference(snap)
+	if snap.Pinned {
+		node.SetColor(pinnedColor)
+	}
+	return node
+}
+
 func snapshotNodeName(snap *snapshot.Snapshot) string {
 	if !snap.BaseImage {
+		if snap.Pinned {
+			return snap.Title + " (pinned)"
+		}
 		return snap.Title
 	}
 
@@ -1,30 +1,115 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/docker/docker/client"
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
 )
 
-var forceGenericSnapshot = flag.Bool("force-generic", false, "disable database aware snapshots")
+var forceGenericSnapshot bool
 
 func main() {
-	flag.Parse()
+	rootCmd := &cobra.Command{
+		Use:          "dksnap",
+		Short:        "Create, view, and run snapshots of Docker containers",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			dockerClient, err := newDockerClient()
+			if err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			return runUI(dockerClient, cfg)
+		},
+	}
+	rootCmd.PersistentPreRun = gcOnStartup
+	rootCmd.PersistentFlags().BoolVar(&forceGenericSnapshot, "force-generic", false,
+		"disable database aware snapshots")
+	rootCmd.AddCommand(
+		newListCommand(),
+		newCreateCommand(),
+		newBootCommand(),
+		newResetCommand(),
+		newRestoreVolumeCommand(),
+		newInspectCommand(),
+		newMigrateCommand(),
+		newEditCommand(),
+		newVerifyCommand(),
+		newPinCommand(),
+		newDeleteCommand(),
+		newDaemonCommand(),
+		newPruneCommand(),
+		newDFCommand(),
+		newGCCommand(),
+	)
+
+	rootCmd.SetArgs(normalizeLegacyFlags(rootCmd, os.Args[1:]))
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
 
+// normalizeLegacyFlags rewrites the single dash form of the root command's
+// flags, such as -force-generic, into the double dash form. Previous versions
+// of dksnap parsed flags with the flag package, which accepts both forms,
+// while cobra would parse -force-generic as a group of shorthand flags.
+func normalizeLegacyFlags(rootCmd *cobra.Command, args []string) []string {
+	normalized := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			copy(normalized[i:], args[i:])
+			break
+		}
+
+		normalized[i] = arg
+		if !strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "--") {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(arg, "-"), "=", 2)[0]
+		if len(name) > 1 && rootCmd.PersistentFlags().Lookup(name) != nil {
+			normalized[i] = "-" + arg
+		}
+	}
+	return normalized
+}
+
+func newDockerClient() (*client.Client, error) {
 	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create Docker client: %s\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("create Docker client: %w", err)
 	}
+	return dockerClient, nil
+}
+
+// runUI runs the interactive terminal UI until the user quits.
+func runUI(dockerClient *client.Client, cfg config) error {
+	// Log messages, such as warnings about snapshots that can't be read,
+	// would corrupt the UI, so they're printed once the UI exits.
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		io.Copy(os.Stderr, &logs)
+	}()
 
 	app := tview.NewApplication()
-	createUI := newCreateUI(dockerClient, app)
+	createUI := newCreateUI(dockerClient, cfg, app)
 	infoUI := newInfoUI(dockerClient, app)
 
 	ctx := context.Background()
@@ -97,8 +182,9 @@ func main() {
 		AddItem(tabbedView, 0, 1, true).
 		AddItem(controls, 2, 1, false)
 	if err := app.SetRoot(root, true).Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to view snapshots: %s\n", err)
+		return fmt.Errorf("view snapshots: %w", err)
 	}
+	return nil
 }
 
 // KeyMapping represents a control used to interact with the UI.
@@ -130,3 +216,22 @@ func alert(app *tview.Application, root *tview.Pages, message string, focusAfter
 			}
 		}), true, true)
 }
+
+// confirm asks the user to confirm an action, and calls onConfirm if they do.
+func confirm(app *tview.Application, root *tview.Pages, message string, onConfirm func(),
+	focusAfter tview.Primitive) {
+	root.AddPage("confirm-modal", tview.NewModal().
+		SetText(message).
+		AddButtons([]string{"Continue", "Cancel"}).
+		SetButtonBackgroundColor(buttonColor).
+		SetDoneFunc(func(_ int, label string) {
+			root.RemovePage("confirm-modal")
+			if label == "Continue" {
+				onConfirm()
+				return
+			}
+			if focusAfter != nil {
+				app.SetFocus(focusAfter)
+			}
+		}), true, true)
+}
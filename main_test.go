@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNormalizeLegacyFlags(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "dksnap"}
+	rootCmd.PersistentFlags().Bool("force-generic", false, "")
+
+	tests := []struct {
+		args, exp []string
+	}{
+		{[]string{"-force-generic"}, []string{"--force-generic"}},
+		{[]string{"-force-generic=false", "list"}, []string{"--force-generic=false", "list"}},
+		{[]string{"--force-generic"}, []string{"--force-generic"}},
+		{[]string{"create", "-t", "title"}, []string{"create", "-t", "title"}},
+		{[]string{"boot", "-unknown"}, []string{"boot", "-unknown"}},
+		{[]string{"boot", "--", "-force-generic"}, []string{"boot", "--", "-force-generic"}},
+	}
+	for _, test := range tests {
+		if actual := normalizeLegacyFlags(rootCmd, test.args); !reflect.DeepEqual(actual, test.exp) {
+			t.Errorf("normalizeLegacyFlags(%v) = %v, expected %v", test.args, actual, test.exp)
+		}
+	}
+}
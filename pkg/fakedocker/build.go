@@ -0,0 +1,315 @@
+package fakedocker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// ImageBuild builds the Dockerfile in the build context, and tags the
+// result with the requested tags. Like the classic Docker builder, each
+// instruction creates an intermediate image. Build failures are reported in
+// the response's JSON message stream.
+func (c *Client) ImageBuild(ctx context.Context, buildContext io.Reader, options types.ImageBuildOptions) (
+	types.ImageBuildResponse, error) {
+	contextFiles := fileMap{}
+	err := extractTar(buildContext, "/", func(path string, f file) {
+		contextFiles[path] = f
+	})
+	if err != nil {
+		return types.ImageBuildResponse{}, err
+	}
+
+	dockerfileName := options.Dockerfile
+	if dockerfileName == "" {
+		dockerfileName = "Dockerfile"
+	}
+	dockerfile, err := contextFiles.read(dockerfileName)
+	if err != nil {
+		return types.ImageBuildResponse{}, errdefs.InvalidParameter(
+			fmt.Errorf("Cannot locate specified Dockerfile: %s", dockerfileName))
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var stream bytes.Buffer
+	messages := json.NewEncoder(&stream)
+	imageID, err := c.build(contextFiles, string(dockerfile), messages)
+	if err != nil {
+		messages.Encode(jsonmessage.JSONMessage{
+			Error:        &jsonmessage.JSONError{Message: err.Error()},
+			ErrorMessage: err.Error(),
+		})
+	} else {
+		messages.Encode(jsonmessage.JSONMessage{
+			Stream: fmt.Sprintf("Successfully built %s\n", stringid.TruncateID(imageID)),
+		})
+		for _, ref := range options.Tags {
+			c.tag(normalizeRef(ref), imageID)
+			messages.Encode(jsonmessage.JSONMessage{
+				Stream: fmt.Sprintf("Successfully tagged %s\n", normalizeRef(ref)),
+			})
+		}
+	}
+
+	return types.ImageBuildResponse{
+		Body:   ioutil.NopCloser(&stream),
+		OSType: "linux",
+	}, nil
+}
+
+// build runs the instructions in the Dockerfile, and returns the ID of the
+// final image.
+func (c *Client) build(contextFiles fileMap, dockerfile string, messages *json.Encoder) (string, error) {
+	instructions := dockerfileInstructions(dockerfile)
+
+	var current *image
+	var cmdSet bool
+	for i, instruction := range instructions {
+		messages.Encode(jsonmessage.JSONMessage{
+			Stream: fmt.Sprintf("Step %d/%d : %s\n", i+1, len(instructions), instruction),
+		})
+
+		if current == nil {
+			keyword, args := splitInstruction(instruction)
+			if keyword != "FROM" {
+				return "", fmt.Errorf("no build stage in current context")
+			}
+
+			base, err := c.findImage(args)
+			if err != nil {
+				return "", err
+			}
+			current = base
+			continue
+		}
+
+		layer := &image{
+			parent: current.id,
+			config: copyConfig(current.config),
+			files:  current.files.copy(),
+		}
+		if err := layer.apply(instruction, contextFiles, &cmdSet); err != nil {
+			return "", err
+		}
+
+		current = c.addImage(layer)
+		messages.Encode(jsonmessage.JSONMessage{
+			Stream: fmt.Sprintf(" ---> %s\n", stringid.TruncateID(current.id)),
+		})
+	}
+
+	if current == nil {
+		return "", fmt.Errorf("the Dockerfile cannot be empty")
+	}
+	return current.id, nil
+}
+
+// apply runs a Dockerfile instruction on top of the layer's parent. cmdSet
+// tracks whether the Dockerfile has set CMD so far.
+func (layer *image) apply(instruction string, contextFiles fileMap, cmdSet *bool) error {
+	layer.createdBy = "/bin/sh -c #(nop)  " + instruction
+
+	keyword, args := splitInstruction(instruction)
+	switch keyword {
+	case "COPY":
+		return copyFiles(layer, contextFiles, strings.Fields(args))
+	case "LABEL":
+		pairs, err := splitPairs(args)
+		if err != nil {
+			return err
+		}
+		if layer.config.Labels == nil {
+			layer.config.Labels = map[string]string{}
+		}
+		for _, pair := range pairs {
+			layer.config.Labels[pair[0]] = pair[1]
+		}
+	case "ENV":
+		pairs, err := splitPairs(args)
+		if err != nil {
+			return err
+		}
+		for _, pair := range pairs {
+			layer.config.Env = setEnv(layer.config.Env, pair[0]+"="+pair[1])
+		}
+	case "ENTRYPOINT":
+		layer.config.Entrypoint = parseCommand(args)
+
+		// Docker discards the base image's CMD when the entrypoint changes.
+		if !*cmdSet {
+			layer.config.Cmd = nil
+		}
+	case "CMD":
+		layer.config.Cmd = parseCommand(args)
+		*cmdSet = true
+	default:
+		return fmt.Errorf("fakedocker doesn't support the %s instruction", keyword)
+	}
+	return nil
+}
+
+// splitInstruction splits a Dockerfile instruction into its keyword and its
+// arguments.
+func splitInstruction(instruction string) (string, string) {
+	keyword, args := instruction, ""
+	if i := strings.IndexFunc(instruction, unicode.IsSpace); i != -1 {
+		keyword, args = instruction[:i], strings.TrimSpace(instruction[i:])
+	}
+	return strings.ToUpper(keyword), args
+}
+
+// copyFiles runs a COPY instruction. Only regular files can be copied.
+func copyFiles(layer *image, contextFiles fileMap, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("COPY requires at least two arguments")
+	}
+
+	sources, dest := args[:len(args)-1], args[len(args)-1]
+	var copied []byte
+	for _, src := range sources {
+		f, ok := contextFiles.stat(src)
+		switch {
+		case !ok:
+			return fmt.Errorf("COPY failed: stat %s: file does not exist", src)
+		case f.mode.IsDir():
+			return fmt.Errorf("fakedocker can't COPY directories: %s", src)
+		}
+
+		target := dest
+		if strings.HasSuffix(dest, "/") || len(sources) > 1 {
+			target = path.Join(dest, path.Base(src))
+		}
+		layer.files[cleanPath(target)] = f
+		layer.size += int64(len(f.content))
+		copied = append(copied, f.content...)
+	}
+	layer.createdBy = fmt.Sprintf("/bin/sh -c #(nop) COPY file:%s in %s ", contentHash(copied), dest)
+	return nil
+}
+
+// dockerfileInstructions returns the instructions in the Dockerfile, with
+// comments removed and continuation lines joined.
+func dockerfileInstructions(dockerfile string) []string {
+	var instructions []string
+	var continued string
+	for _, line := range strings.Split(dockerfile, "\n") {
+		line = strings.TrimSpace(line)
+		if continued == "" && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+
+		if strings.HasSuffix(line, "\\") {
+			continued += strings.TrimSuffix(line, "\\")
+			continue
+		}
+		instructions = append(instructions, continued+line)
+		continued = ""
+	}
+	if continued != "" {
+		instructions = append(instructions, continued)
+	}
+	return instructions
+}
+
+// splitPairs parses the key=value arguments of LABEL and ENV instructions.
+// Quotes are removed and backslash escapes are resolved like Docker does.
+func splitPairs(args string) ([][2]string, error) {
+	var pairs [][2]string
+	var word strings.Builder
+	var key string
+	var quote rune
+	var inWord, haveKey, escaped bool
+
+	endWord := func() error {
+		if !haveKey {
+			return fmt.Errorf("missing = in %q", word.String())
+		}
+		pairs = append(pairs, [2]string{key, word.String()})
+		word.Reset()
+		inWord, haveKey = false, false
+		return nil
+	}
+
+	for _, r := range args {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == '=' && !haveKey:
+			key = word.String()
+			word.Reset()
+			haveKey, inWord = true, true
+		case unicode.IsSpace(r):
+			if inWord {
+				if err := endWord(); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in %q", args)
+	}
+	if inWord {
+		if err := endWord(); err != nil {
+			return nil, err
+		}
+	}
+	return pairs, nil
+}
+
+// parseCommand parses the arguments of ENTRYPOINT and CMD instructions,
+// which are either a JSON array, or a shell command.
+func parseCommand(args string) []string {
+	var cmd []string
+	if strings.HasPrefix(args, "[") && json.Unmarshal([]byte(args), &cmd) == nil {
+		return cmd
+	}
+	return []string{"/bin/sh", "-c", args}
+}
+
+// setEnv sets the variable in env, which is a list of KEY=VALUE strings.
+func setEnv(env []string, variable string) []string {
+	key := strings.SplitN(variable, "=", 2)[0]
+	for i, existing := range env {
+		if strings.SplitN(existing, "=", 2)[0] == key {
+			updated := append([]string(nil), env...)
+			updated[i] = variable
+			return updated
+		}
+	}
+	return append(env, variable)
+}
@@ -0,0 +1,352 @@
+// Package fakedocker is an in-memory fake of the parts of the Docker API
+// that dksnap uses, so that snapshots can be tested without a Docker daemon.
+//
+// Images are modelled as a parent, a config, and the complete contents of
+// their filesystem. Builds support the FROM, COPY, LABEL, ENV, ENTRYPOINT,
+// and CMD instructions, and create an intermediate image for each
+// instruction like the classic Docker builder. Containers get a copy of
+// their image's filesystem, with volumes and bind mounts layered on top.
+//
+// Containers don't actually run anything. Starting a container marks it as
+// running until it's stopped or Exit is called, and the commands run with
+// `docker exec` are handled by the client's Exec function.
+package fakedocker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+)
+
+// Client is a fake Docker client. The zero value isn't usable, so clients
+// must be created with New.
+type Client struct {
+	// Exec handles the commands run in containers with `docker exec`. If
+	// it's nil, all commands fail as if they weren't installed.
+	Exec ExecFunc
+
+	lock       sync.Mutex
+	nextID     int
+	images     map[string]*image
+	tags       map[string]string
+	containers map[string]*container
+	execs      map[string]*execInstance
+	volumes    map[string]*volume
+	binds      map[string]fileMap
+	networks   map[string]types.NetworkResource
+}
+
+// ExecFunc runs the command in the container with the given ID. env
+// contains the environment variables set for the command in addition to the
+// container's environment.
+type ExecFunc func(containerID string, cmd, env []string) ExecResult
+
+// ExecResult is the output of a command run with ExecFunc.
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Image describes an image added with AddImage.
+type Image struct {
+	Labels     map[string]string
+	Env        []string
+	Entrypoint []string
+	Cmd        []string
+
+	// Files maps absolute paths in the image to their contents.
+	Files map[string]string
+}
+
+// New creates an empty fake Docker client. Like a fresh Docker daemon, it
+// has the default bridge, host, and none networks.
+func New() *Client {
+	c := &Client{
+		images:     map[string]*image{},
+		tags:       map[string]string{},
+		containers: map[string]*container{},
+		execs:      map[string]*execInstance{},
+		volumes:    map[string]*volume{},
+		binds:      map[string]fileMap{},
+		networks:   map[string]types.NetworkResource{},
+	}
+	for _, name := range []string{"bridge", "host", "none"} {
+		c.networks[name] = types.NetworkResource{
+			Name:   name,
+			ID:     c.newID(),
+			Driver: name,
+			Scope:  "local",
+		}
+	}
+	return c
+}
+
+// AddImage adds an image with a single layer, and tags it with ref. It
+// returns the ID of the new image.
+func (c *Client) AddImage(ref string, img Image) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	files := fileMap{}
+	var size int64
+	for path, content := range img.Files {
+		files[cleanPath(path)] = newFile([]byte(content), 0644)
+		size += int64(len(content))
+	}
+
+	labels := map[string]string{}
+	for k, v := range img.Labels {
+		labels[k] = v
+	}
+
+	added := c.addImage(&image{
+		config: containerTypes.Config{
+			Labels:     labels,
+			Env:        img.Env,
+			Entrypoint: img.Entrypoint,
+			Cmd:        img.Cmd,
+		},
+		files:     files,
+		createdBy: "/bin/sh -c #(nop) ADD rootfs.tar in / ",
+		size:      size,
+	})
+	c.tag(normalizeRef(ref), added.id)
+	return added.id
+}
+
+// AddNetwork adds a network that containers can be connected to.
+func (c *Client) AddNetwork(name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.networks[name] = types.NetworkResource{
+		Name:   name,
+		ID:     c.newID(),
+		Driver: "bridge",
+		Scope:  "local",
+	}
+}
+
+// AddVolume creates a volume with the given files. The paths are relative
+// to the root of the volume.
+func (c *Client) AddVolume(name string, files map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	vol := c.getOrCreateVolume(name)
+	for path, content := range files {
+		vol.files[cleanPath(path)] = newFile([]byte(content), 0644)
+	}
+}
+
+// WriteFile writes a file in the container, as if a process in the container
+// wrote it. Files written within a mount are written to the mount.
+func (c *Client) WriteFile(containerRef, path string, content []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	files, key := ctr.resolve(path)
+	files[key] = newFile(content, 0644)
+	return nil
+}
+
+// ReadFile reads a file from the filesystem of the container.
+func (c *Client) ReadFile(containerRef, path string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return nil, err
+	}
+	return ctr.view().read(path)
+}
+
+// ReadImageFile reads a file from the filesystem of the image.
+func (c *Client) ReadImageFile(imageRef, path string) ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	img, err := c.findImage(imageRef)
+	if err != nil {
+		return nil, err
+	}
+	return img.files.read(path)
+}
+
+// WriteLogs appends to the output of the container's main process.
+func (c *Client) WriteLogs(containerRef, logs string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	ctr.logs = append(ctr.logs, logs...)
+	return nil
+}
+
+// Exit simulates the container's main process exiting with the given code.
+// Containers created with --rm are removed.
+func (c *Client) Exit(containerRef string, exitCode int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	if !ctr.running {
+		return errdefs.Conflict(fmt.Errorf("container %s is not running", ctr.id))
+	}
+	c.exit(ctr, exitCode)
+	return nil
+}
+
+// newID returns a unique ID in the format that Docker uses for containers.
+// Image IDs are prefixed with "sha256:".
+func (c *Client) newID() string {
+	c.nextID++
+	return contentHash([]byte(fmt.Sprintf("fakedocker-%d", c.nextID)))
+}
+
+// findImage returns the image with the given name or ID. IDs can be
+// shortened to any unique prefix.
+func (c *Client) findImage(ref string) (*image, error) {
+	if id, ok := c.tags[normalizeRef(ref)]; ok {
+		return c.images[id], nil
+	}
+
+	prefix := strings.TrimPrefix(ref, "sha256:")
+	if prefix != "" && isHex(prefix) {
+		var matches []*image
+		for id, img := range c.images {
+			if strings.HasPrefix(strings.TrimPrefix(id, "sha256:"), prefix) {
+				matches = append(matches, img)
+			}
+		}
+		switch len(matches) {
+		case 1:
+			return matches[0], nil
+		case 0:
+		default:
+			return nil, errdefs.InvalidParameter(fmt.Errorf("ambiguous image ID %s", ref))
+		}
+	}
+	return nil, errdefs.NotFound(fmt.Errorf("No such image: %s", ref))
+}
+
+// findContainer returns the container with the given name or ID. IDs can be
+// shortened to any unique prefix.
+func (c *Client) findContainer(ref string) (*container, error) {
+	if ctr, ok := c.containers[ref]; ok {
+		return ctr, nil
+	}
+
+	name := "/" + strings.TrimPrefix(ref, "/")
+	var matches []*container
+	for _, ctr := range c.containers {
+		if ctr.name == name {
+			return ctr, nil
+		}
+		if ref != "" && strings.HasPrefix(ctr.id, ref) {
+			matches = append(matches, ctr)
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, errdefs.NotFound(fmt.Errorf("No such container: %s", ref))
+	default:
+		return nil, errdefs.InvalidParameter(fmt.Errorf("ambiguous container ID %s", ref))
+	}
+}
+
+// sortedContainers returns the containers from newest to oldest, which is
+// the order that Docker lists them in.
+func (c *Client) sortedContainers() []*container {
+	var containers []*container
+	for _, ctr := range c.containers {
+		containers = append(containers, ctr)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].seq > containers[j].seq
+	})
+	return containers
+}
+
+func (c *Client) getOrCreateVolume(name string) *volume {
+	if vol, ok := c.volumes[name]; ok {
+		return vol
+	}
+
+	vol := &volume{
+		info: types.Volume{
+			Name:       name,
+			Driver:     "local",
+			Mountpoint: fmt.Sprintf("/var/lib/docker/volumes/%s/_data", name),
+			CreatedAt:  time.Now().Format(time.RFC3339),
+			Labels:     map[string]string{},
+			Scope:      "local",
+		},
+		files: fileMap{},
+	}
+	c.volumes[name] = vol
+	return vol
+}
+
+// normalizeRef converts an image name into the form used by RepoTags, so
+// that "postgres" and "docker.io/library/postgres:latest" refer to the same
+// image.
+func normalizeRef(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	ref = strings.TrimPrefix(ref, "library/")
+	if !strings.Contains(ref[strings.LastIndex(ref, "/")+1:], ":") {
+		ref += ":latest"
+	}
+	return ref
+}
+
+func contentHash(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+func newFile(content []byte, perm os.FileMode) file {
+	return file{
+		mode:    perm,
+		content: content,
+		modTime: time.Now(),
+	}
+}
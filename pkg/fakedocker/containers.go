@@ -0,0 +1,923 @@
+package fakedocker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	mountTypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+type container struct {
+	id      string
+	name    string
+	seq     int
+	imageID string
+	created time.Time
+
+	config     containerTypes.Config
+	hostConfig containerTypes.HostConfig
+	networks   map[string]*network.EndpointSettings
+
+	// rootfs is the container's filesystem, not including its mounts.
+	rootfs fileMap
+	mounts []*mountPoint
+
+	running    bool
+	paused     bool
+	started    bool
+	exitCode   int
+	startedAt  time.Time
+	finishedAt time.Time
+	logs       []byte
+	waiters    []waiter
+}
+
+// mountPoint is a volume, bind mount, or tmpfs mounted in a container. The
+// files are shared by all the containers that mount the same volume or host
+// path, and are keyed by their path relative to the root of the mount.
+type mountPoint struct {
+	point types.MountPoint
+	files fileMap
+
+	// hidden is set for mounts created with --tmpfs, which Docker doesn't
+	// include in the container's mounts.
+	hidden bool
+}
+
+type volume struct {
+	info  types.Volume
+	files fileMap
+}
+
+// waiter is notified with the container's exit code when the condition is
+// met.
+type waiter struct {
+	condition containerTypes.WaitCondition
+	exited    chan int
+}
+
+func (ctr *container) status() string {
+	switch {
+	case ctr.paused:
+		return "paused"
+	case ctr.running:
+		return "running"
+	case ctr.started:
+		return "exited"
+	default:
+		return "created"
+	}
+}
+
+// command returns the command run by the container's main process.
+func (ctr *container) command() []string {
+	return append(append([]string(nil), ctr.config.Entrypoint...), ctr.config.Cmd...)
+}
+
+// stop marks the container as stopped, and notifies the waiters.
+func (ctr *container) stop(exitCode int) {
+	ctr.running = false
+	ctr.paused = false
+	ctr.exitCode = exitCode
+	ctr.finishedAt = time.Now()
+	ctr.notify(func(w waiter) bool {
+		return w.condition != containerTypes.WaitConditionRemoved
+	})
+}
+
+func (ctr *container) notify(shouldNotify func(waiter) bool) {
+	var remaining []waiter
+	for _, w := range ctr.waiters {
+		if shouldNotify(w) {
+			w.exited <- ctr.exitCode
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	ctr.waiters = remaining
+}
+
+// resolve returns the files that contain the path, and the path's key within
+// them.
+func (ctr *container) resolve(p string) (fileMap, string) {
+	p = cleanPath(p)
+	var mount *mountPoint
+	for _, m := range ctr.mounts {
+		dest := m.point.Destination
+		if (p == dest || strings.HasPrefix(p, dest+"/")) &&
+			(mount == nil || len(dest) > len(mount.point.Destination)) {
+			mount = m
+		}
+	}
+
+	if mount == nil {
+		return ctr.rootfs, p
+	}
+	return mount.files, cleanPath(strings.TrimPrefix(p, mount.point.Destination))
+}
+
+// view returns the filesystem as seen from within the container, with the
+// mounts layered on top of the root filesystem.
+func (ctr *container) view() fileMap {
+	view := fileMap{}
+	for p, f := range ctr.rootfs {
+		if !ctr.shadowed(p) {
+			view[p] = f
+		}
+	}
+	for _, m := range ctr.mounts {
+		view[m.point.Destination] = newDir()
+		for p, f := range m.files {
+			view[cleanPath(path.Join(m.point.Destination, p))] = f
+		}
+	}
+	return view
+}
+
+// shadowed returns whether the path in the root filesystem is hidden by a
+// mount.
+func (ctr *container) shadowed(p string) bool {
+	for _, m := range ctr.mounts {
+		dest := m.point.Destination
+		if p == dest || strings.HasPrefix(p, dest+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (ctr *container) mountPoints() []types.MountPoint {
+	var points []types.MountPoint
+	for _, m := range ctr.mounts {
+		if !m.hidden {
+			points = append(points, m.point)
+		}
+	}
+	return points
+}
+
+// ContainerCreate creates a container from the image in the config. The
+// container's config inherits the labels, environment, entrypoint, and
+// command of the image. Named volumes are created if they don't exist.
+func (c *Client) ContainerCreate(ctx context.Context, config *containerTypes.Config,
+	hostConfig *containerTypes.HostConfig, networkingConfig *network.NetworkingConfig, containerName string) (
+	containerTypes.ContainerCreateCreatedBody, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if config == nil {
+		return containerTypes.ContainerCreateCreatedBody{}, errdefs.InvalidParameter(
+			fmt.Errorf("config cannot be empty in order to create a container"))
+	}
+
+	img, err := c.findImage(config.Image)
+	if err != nil {
+		return containerTypes.ContainerCreateCreatedBody{}, err
+	}
+
+	id := c.newID()
+	if containerName == "" {
+		containerName = fmt.Sprintf("fakedocker_%d", c.nextID)
+	}
+	if err := c.checkNameAvailable(containerName); err != nil {
+		return containerTypes.ContainerCreateCreatedBody{}, err
+	}
+
+	ctr := &container{
+		id:       id,
+		name:     "/" + containerName,
+		seq:      c.nextID,
+		imageID:  img.id,
+		created:  time.Now(),
+		config:   copyConfig(*config),
+		networks: map[string]*network.EndpointSettings{},
+		rootfs:   img.files.copy(),
+	}
+	if hostConfig != nil {
+		ctr.hostConfig = *hostConfig
+	}
+
+	ctr.config.Labels = copyLabels(img.config.Labels)
+	for k, v := range config.Labels {
+		ctr.config.Labels[k] = v
+	}
+	ctr.config.Env = append([]string(nil), img.config.Env...)
+	for _, variable := range config.Env {
+		ctr.config.Env = setEnv(ctr.config.Env, variable)
+	}
+	if len(config.Entrypoint) == 0 {
+		ctr.config.Entrypoint = img.config.Entrypoint
+		if len(config.Cmd) == 0 {
+			ctr.config.Cmd = img.config.Cmd
+		}
+	}
+
+	if err := c.addMounts(ctr); err != nil {
+		return containerTypes.ContainerCreateCreatedBody{}, err
+	}
+
+	if networkingConfig != nil && len(networkingConfig.EndpointsConfig) != 0 {
+		for name, endpoint := range networkingConfig.EndpointsConfig {
+			if err := c.connect(ctr, name, endpoint); err != nil {
+				return containerTypes.ContainerCreateCreatedBody{}, err
+			}
+		}
+	} else {
+		mode := string(ctr.hostConfig.NetworkMode)
+		if mode == "" || mode == "default" {
+			mode = "bridge"
+		}
+		if !strings.HasPrefix(mode, "container:") {
+			if err := c.connect(ctr, mode, nil); err != nil {
+				return containerTypes.ContainerCreateCreatedBody{}, err
+			}
+		}
+	}
+
+	c.containers[id] = ctr
+	return containerTypes.ContainerCreateCreatedBody{ID: id}, nil
+}
+
+func (c *Client) checkNameAvailable(name string) error {
+	for _, ctr := range c.containers {
+		if ctr.name == "/"+name {
+			return errdefs.Conflict(fmt.Errorf("Conflict. The container name %q is already in use by "+
+				"container %q. You have to remove (or rename) that container to be able to reuse that name.",
+				ctr.name, ctr.id))
+		}
+	}
+	return nil
+}
+
+// addMounts mounts the volumes, bind mounts, and tmpfs mounts in the
+// container's host config.
+func (c *Client) addMounts(ctr *container) error {
+	for _, bind := range ctr.hostConfig.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return errdefs.InvalidParameter(fmt.Errorf("invalid volume specification: %q", bind))
+		}
+
+		var mode string
+		if len(parts) == 3 {
+			mode = parts[2]
+		}
+		readOnly := strings.Contains(mode, "ro")
+		if strings.HasPrefix(parts[0], "/") {
+			ctr.mounts = append(ctr.mounts, c.bindMount(parts[0], parts[1], mode, readOnly))
+		} else {
+			ctr.mounts = append(ctr.mounts, c.volumeMount(parts[0], parts[1], mode, readOnly))
+		}
+	}
+
+	for _, m := range ctr.hostConfig.Mounts {
+		switch m.Type {
+		case mountTypes.TypeVolume:
+			name := m.Source
+			if name == "" {
+				name = c.newID()
+			}
+			ctr.mounts = append(ctr.mounts, c.volumeMount(name, m.Target, "", m.ReadOnly))
+		case mountTypes.TypeBind:
+			ctr.mounts = append(ctr.mounts, c.bindMount(m.Source, m.Target, "", m.ReadOnly))
+		case mountTypes.TypeTmpfs:
+			ctr.mounts = append(ctr.mounts, tmpfsMount(m.Target, false))
+		default:
+			return errdefs.InvalidParameter(fmt.Errorf("fakedocker doesn't support %s mounts", m.Type))
+		}
+	}
+
+	for path := range ctr.hostConfig.Tmpfs {
+		ctr.mounts = append(ctr.mounts, tmpfsMount(path, true))
+	}
+
+	for _, ref := range ctr.hostConfig.VolumesFrom {
+		source, err := c.findContainer(strings.SplitN(ref, ":", 2)[0])
+		if err != nil {
+			return err
+		}
+		for _, m := range source.mounts {
+			if !m.hidden {
+				ctr.mounts = append(ctr.mounts, m)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Client) volumeMount(name, dest, mode string, readOnly bool) *mountPoint {
+	vol := c.getOrCreateVolume(name)
+	return &mountPoint{
+		point: types.MountPoint{
+			Type:        mountTypes.TypeVolume,
+			Name:        name,
+			Source:      vol.info.Mountpoint,
+			Destination: cleanPath(dest),
+			Driver:      "local",
+			Mode:        mode,
+			RW:          !readOnly,
+		},
+		files: vol.files,
+	}
+}
+
+func (c *Client) bindMount(source, dest, mode string, readOnly bool) *mountPoint {
+	source = cleanPath(source)
+	if _, ok := c.binds[source]; !ok {
+		c.binds[source] = fileMap{}
+	}
+	return &mountPoint{
+		point: types.MountPoint{
+			Type:        mountTypes.TypeBind,
+			Source:      source,
+			Destination: cleanPath(dest),
+			Mode:        mode,
+			RW:          !readOnly,
+			Propagation: mountTypes.PropagationRPrivate,
+		},
+		files: c.binds[source],
+	}
+}
+
+func tmpfsMount(dest string, hidden bool) *mountPoint {
+	return &mountPoint{
+		point: types.MountPoint{
+			Type:        mountTypes.TypeTmpfs,
+			Destination: cleanPath(dest),
+			RW:          true,
+		},
+		files:  fileMap{},
+		hidden: hidden,
+	}
+}
+
+// connect connects the container to the network.
+func (c *Client) connect(ctr *container, networkName string, endpoint *network.EndpointSettings) error {
+	resource, ok := c.networks[networkName]
+	if !ok {
+		return errdefs.NotFound(fmt.Errorf("network %s not found", networkName))
+	}
+
+	settings := &network.EndpointSettings{}
+	if endpoint != nil {
+		copied := *endpoint
+		settings = &copied
+	}
+	settings.NetworkID = resource.ID
+	settings.EndpointID = c.newID()
+	ctr.networks[networkName] = settings
+	return nil
+}
+
+// ContainerInspect returns the container's configuration and state.
+func (c *Client) ContainerInspect(ctx context.Context, containerRef string) (types.ContainerJSON, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+
+	state := &types.ContainerState{
+		Status:     ctr.status(),
+		Running:    ctr.running,
+		Paused:     ctr.paused,
+		ExitCode:   ctr.exitCode,
+		StartedAt:  ctr.startedAt.Format(time.RFC3339Nano),
+		FinishedAt: ctr.finishedAt.Format(time.RFC3339Nano),
+	}
+	if ctr.running {
+		state.Pid = ctr.seq
+	}
+
+	var cmdPath string
+	var args []string
+	if cmd := ctr.command(); len(cmd) != 0 {
+		cmdPath, args = cmd[0], cmd[1:]
+	}
+
+	config := copyConfig(ctr.config)
+	hostConfig := ctr.hostConfig
+	networks := map[string]*network.EndpointSettings{}
+	for name, endpoint := range ctr.networks {
+		copied := *endpoint
+		networks[name] = &copied
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         ctr.id,
+			Created:    ctr.created.Format(time.RFC3339Nano),
+			Path:       cmdPath,
+			Args:       args,
+			State:      state,
+			Image:      ctr.imageID,
+			Name:       ctr.name,
+			Driver:     "overlay2",
+			Platform:   "linux",
+			HostConfig: &hostConfig,
+		},
+		Mounts: ctr.mountPoints(),
+		Config: &config,
+		NetworkSettings: &types.NetworkSettings{
+			Networks: networks,
+		},
+	}, nil
+}
+
+// ContainerList lists the containers from newest to oldest. Stopped
+// containers are only included if All is set. The id, name, label, volume,
+// and status filters are supported.
+func (c *Client) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := options.Filters.Validate(map[string]bool{
+		"id":     true,
+		"name":   true,
+		"label":  true,
+		"volume": true,
+		"status": true,
+	})
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+
+	var containers []types.Container
+	for _, ctr := range c.sortedContainers() {
+		if !options.All && !ctr.running {
+			continue
+		}
+		if !c.matchesFilters(ctr, options) {
+			continue
+		}
+
+		status := "Created"
+		switch {
+		case ctr.paused:
+			status = "Up (Paused)"
+		case ctr.running:
+			status = "Up"
+		case ctr.started:
+			status = fmt.Sprintf("Exited (%d)", ctr.exitCode)
+		}
+
+		networks := map[string]*network.EndpointSettings{}
+		for name, endpoint := range ctr.networks {
+			copied := *endpoint
+			networks[name] = &copied
+		}
+
+		summary := types.Container{
+			ID:              ctr.id,
+			Names:           []string{ctr.name},
+			Image:           ctr.config.Image,
+			ImageID:         ctr.imageID,
+			Command:         strings.Join(ctr.command(), " "),
+			Created:         ctr.created.Unix(),
+			Labels:          copyLabels(ctr.config.Labels),
+			State:           ctr.status(),
+			Status:          status,
+			NetworkSettings: &types.SummaryNetworkSettings{Networks: networks},
+			Mounts:          ctr.mountPoints(),
+		}
+		summary.HostConfig.NetworkMode = string(ctr.hostConfig.NetworkMode)
+		containers = append(containers, summary)
+	}
+	return containers, nil
+}
+
+func (c *Client) matchesFilters(ctr *container, options types.ContainerListOptions) bool {
+	args := options.Filters
+	if args.Contains("id") {
+		matches := false
+		for _, id := range args.Get("id") {
+			matches = matches || strings.HasPrefix(ctr.id, id)
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	if args.Contains("volume") {
+		matches := false
+		for _, ref := range args.Get("volume") {
+			for _, m := range ctr.mounts {
+				matches = matches || m.point.Name == ref || m.point.Destination == ref
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+
+	return args.Match("name", strings.TrimPrefix(ctr.name, "/")) &&
+		args.MatchKVList("label", ctr.config.Labels) &&
+		(!args.Contains("status") || args.ExactMatch("status", ctr.status()))
+}
+
+// ContainerStart marks the container as running. Nothing actually runs in
+// the container. Use Exit to simulate the container's process exiting.
+func (c *Client) ContainerStart(ctx context.Context, containerRef string, options types.ContainerStartOptions) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	c.start(ctr)
+	return nil
+}
+
+func (c *Client) start(ctr *container) {
+	if ctr.running {
+		return
+	}
+	ctr.running = true
+	ctr.started = true
+	ctr.exitCode = 0
+	ctr.startedAt = time.Now()
+}
+
+// ContainerStop stops the container. Containers created with --rm are
+// removed.
+func (c *Client) ContainerStop(ctx context.Context, containerRef string, timeout *time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	if ctr.running {
+		c.exit(ctr, 0)
+	}
+	return nil
+}
+
+// exit stops the container, and removes it if it was created with --rm.
+func (c *Client) exit(ctr *container, exitCode int) {
+	ctr.stop(exitCode)
+	if ctr.hostConfig.AutoRemove {
+		delete(c.containers, ctr.id)
+		ctr.notify(func(waiter) bool { return true })
+	}
+}
+
+// ContainerRestart stops the container if it's running, and starts it.
+func (c *Client) ContainerRestart(ctx context.Context, containerRef string, timeout *time.Duration) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	if ctr.running {
+		ctr.stop(0)
+	}
+	c.start(ctr)
+	return nil
+}
+
+// ContainerPause pauses the container.
+func (c *Client) ContainerPause(ctx context.Context, containerRef string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !ctr.running:
+		return errdefs.Conflict(fmt.Errorf("Container %s is not running", ctr.id))
+	case ctr.paused:
+		return errdefs.Conflict(fmt.Errorf("Container %s is already paused", ctr.id))
+	}
+	ctr.paused = true
+	return nil
+}
+
+// ContainerUnpause unpauses the container.
+func (c *Client) ContainerUnpause(ctx context.Context, containerRef string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	if !ctr.paused {
+		return errdefs.Conflict(fmt.Errorf("Container %s is not paused", ctr.id))
+	}
+	ctr.paused = false
+	return nil
+}
+
+// ContainerRemove removes the container. Running containers are only
+// removed if Force is set.
+func (c *Client) ContainerRemove(ctx context.Context, containerRef string,
+	options types.ContainerRemoveOptions) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+
+	if ctr.running {
+		if !options.Force {
+			return errdefs.Conflict(fmt.Errorf("You cannot remove a running container %s. Stop the "+
+				"container before attempting removal or force remove", ctr.id))
+		}
+		ctr.stop(137)
+	}
+
+	delete(c.containers, ctr.id)
+	ctr.notify(func(waiter) bool { return true })
+	return nil
+}
+
+// ContainerRename renames the container.
+func (c *Client) ContainerRename(ctx context.Context, containerRef, newContainerName string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+
+	newContainerName = strings.TrimPrefix(newContainerName, "/")
+	if ctr.name == "/"+newContainerName {
+		return nil
+	}
+	if err := c.checkNameAvailable(newContainerName); err != nil {
+		return err
+	}
+	ctr.name = "/" + newContainerName
+	return nil
+}
+
+// ContainerTop reports the container's entrypoint and command as its
+// processes. The arguments to ps are ignored, and the processes are listed
+// with a PID and COMMAND column.
+func (c *Client) ContainerTop(ctx context.Context, containerRef string, arguments []string) (
+	containerTypes.ContainerTopOKBody, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return containerTypes.ContainerTopOKBody{}, err
+	}
+	if !ctr.running {
+		return containerTypes.ContainerTopOKBody{}, errdefs.Conflict(
+			fmt.Errorf("Container %s is not running", ctr.id))
+	}
+
+	top := containerTypes.ContainerTopOKBody{Titles: []string{"PID", "COMMAND"}}
+	cmd := ctr.command()
+	if len(cmd) > 2 {
+		cmd = cmd[:2]
+	}
+	for i, process := range cmd {
+		top.Processes = append(top.Processes, []string{strconv.Itoa(i + 1), path.Base(process)})
+	}
+	return top, nil
+}
+
+// ContainerWait waits for the container to meet the condition.
+func (c *Client) ContainerWait(ctx context.Context, containerRef string, condition containerTypes.WaitCondition) (
+	<-chan containerTypes.ContainerWaitOKBody, <-chan error) {
+	resultCh := make(chan containerTypes.ContainerWaitOKBody, 1)
+	errCh := make(chan error, 1)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		errCh <- err
+		return resultCh, errCh
+	}
+
+	if condition == "" {
+		condition = containerTypes.WaitConditionNotRunning
+	}
+	if condition == containerTypes.WaitConditionNotRunning && !ctr.running {
+		resultCh <- containerTypes.ContainerWaitOKBody{StatusCode: int64(ctr.exitCode)}
+		return resultCh, errCh
+	}
+
+	exited := make(chan int, 1)
+	ctr.waiters = append(ctr.waiters, waiter{condition: condition, exited: exited})
+	go func() {
+		select {
+		case exitCode := <-exited:
+			resultCh <- containerTypes.ContainerWaitOKBody{StatusCode: int64(exitCode)}
+		case <-ctx.Done():
+			errCh <- ctx.Err()
+		}
+	}()
+	return resultCh, errCh
+}
+
+// ContainerLogs returns the logs written with WriteLogs. If Follow is set and
+// the container is running, the stream stays open until the container stops
+// or the context is cancelled.
+func (c *Client) ContainerLogs(ctx context.Context, containerRef string, options types.ContainerLogsOptions) (
+	io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs bytes.Buffer
+	if options.ShowStdout {
+		if ctr.config.Tty {
+			logs.Write(ctr.logs)
+		} else {
+			stdcopy.NewStdWriter(&logs, stdcopy.Stdout).Write(ctr.logs)
+		}
+	}
+	if !options.Follow || !ctr.running {
+		return ioutil.NopCloser(&logs), nil
+	}
+
+	exited := make(chan int, 1)
+	ctr.waiters = append(ctr.waiters, waiter{condition: containerTypes.WaitConditionNotRunning, exited: exited})
+
+	r, w := io.Pipe()
+	go func() {
+		if _, err := w.Write(logs.Bytes()); err != nil {
+			return
+		}
+		select {
+		case <-exited:
+		case <-ctx.Done():
+		}
+		w.Close()
+	}()
+	return r, nil
+}
+
+// ContainerCommit creates an image from the container's filesystem, not
+// including its mounts. The LABEL, ENV, ENTRYPOINT, and CMD changes are
+// supported.
+func (c *Client) ContainerCommit(ctx context.Context, containerRef string, options types.ContainerCommitOptions) (
+	types.IDResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return types.IDResponse{}, err
+	}
+
+	layer := &image{
+		parent: ctr.imageID,
+		config: copyConfig(ctr.config),
+		files:  ctr.rootfs.copy(),
+	}
+	parentFiles := fileMap{}
+	if parent, ok := c.images[ctr.imageID]; ok {
+		parentFiles = parent.files
+	}
+	for p, f := range layer.files {
+		if parentFile, ok := parentFiles[p]; !ok || parentFile.mode != f.mode ||
+			!bytes.Equal(parentFile.content, f.content) {
+			layer.size += int64(len(f.content))
+		}
+	}
+
+	cmdSet := true
+	for _, change := range options.Changes {
+		if err := layer.apply(change, nil, &cmdSet); err != nil {
+			return types.IDResponse{}, errdefs.InvalidParameter(err)
+		}
+	}
+	layer.createdBy = strings.Join(ctr.command(), " ")
+
+	committed := c.addImage(layer)
+	if options.Reference != "" {
+		c.tag(normalizeRef(options.Reference), committed.id)
+	}
+	return types.IDResponse{ID: committed.id}, nil
+}
+
+// CopyFromContainer returns a tarball of the file or directory at the path.
+func (c *Client) CopyFromContainer(ctx context.Context, containerRef, srcPath string) (
+	io.ReadCloser, types.ContainerPathStat, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+
+	view := ctr.view()
+	f, ok := view.stat(srcPath)
+	if !ok {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(
+			fmt.Errorf("Could not find the file %s in container %s", srcPath, containerRef))
+	}
+
+	var archive bytes.Buffer
+	if err := view.archive(&archive, srcPath); err != nil {
+		return nil, types.ContainerPathStat{}, err
+	}
+	return ioutil.NopCloser(&archive), types.ContainerPathStat{
+		Name:  path.Base(cleanPath(srcPath)),
+		Size:  int64(len(f.content)),
+		Mode:  f.mode,
+		Mtime: f.modTime,
+	}, nil
+}
+
+// CopyToContainer extracts the tarball into the directory at the path.
+func (c *Client) CopyToContainer(ctx context.Context, containerRef, dstPath string, content io.Reader,
+	options types.CopyToContainerOptions) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+
+	f, ok := ctr.view().stat(dstPath)
+	switch {
+	case !ok:
+		return errdefs.NotFound(fmt.Errorf("Could not find the file %s in container %s", dstPath, containerRef))
+	case !f.mode.IsDir():
+		return errdefs.InvalidParameter(fmt.Errorf("extraction point is not a directory"))
+	}
+
+	return extractTar(content, dstPath, func(p string, f file) {
+		files, key := ctr.resolve(p)
+		files[key] = f
+	})
+}
+
+// NetworkInspect returns the network with the given name.
+func (c *Client) NetworkInspect(ctx context.Context, networkName string, options types.NetworkInspectOptions) (
+	types.NetworkResource, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	resource, ok := c.networks[networkName]
+	if !ok {
+		return types.NetworkResource{}, errdefs.NotFound(fmt.Errorf("network %s not found", networkName))
+	}
+	return resource, nil
+}
+
+// NetworkConnect connects the container to the network.
+func (c *Client) NetworkConnect(ctx context.Context, networkName, containerRef string,
+	config *network.EndpointSettings) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctr.networks[networkName]; ok {
+		return errdefs.Forbidden(fmt.Errorf("container %s is already attached to network %s",
+			ctr.id, networkName))
+	}
+	return c.connect(ctr, networkName, config)
+}
+
+// VolumeInspect returns the volume with the given name.
+func (c *Client) VolumeInspect(ctx context.Context, volumeID string) (types.Volume, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	vol, ok := c.volumes[volumeID]
+	if !ok {
+		return types.Volume{}, errdefs.NotFound(fmt.Errorf("get %s: no such volume", volumeID))
+	}
+	return vol.info, nil
+}
@@ -0,0 +1,115 @@
+package fakedocker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// execInstance is a command created with ContainerExecCreate.
+type execInstance struct {
+	id          string
+	containerID string
+	cmd         []string
+	env         []string
+	running     bool
+	exitCode    int
+}
+
+// ContainerExecCreate creates a command to run in the container. The
+// container must be running.
+func (c *Client) ContainerExecCreate(ctx context.Context, containerRef string, config types.ExecConfig) (
+	types.IDResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ctr, err := c.findContainer(containerRef)
+	if err != nil {
+		return types.IDResponse{}, err
+	}
+	switch {
+	case len(config.Cmd) == 0:
+		return types.IDResponse{}, errdefs.InvalidParameter(fmt.Errorf("No exec command specified"))
+	case !ctr.running:
+		return types.IDResponse{}, errdefs.Conflict(fmt.Errorf("Container %s is not running", ctr.id))
+	case ctr.paused:
+		return types.IDResponse{}, errdefs.Conflict(fmt.Errorf("Container %s is paused, unpause the "+
+			"container before exec", ctr.id))
+	}
+
+	exec := &execInstance{
+		id:          c.newID(),
+		containerID: ctr.id,
+		cmd:         config.Cmd,
+		env:         config.Env,
+	}
+	c.execs[exec.id] = exec
+	return types.IDResponse{ID: exec.id}, nil
+}
+
+// ContainerExecAttach runs the command with the client's Exec function, and
+// returns its output multiplexed like Docker does for containers without a
+// TTY.
+func (c *Client) ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (
+	types.HijackedResponse, error) {
+	c.lock.Lock()
+	exec, ok := c.execs[execID]
+	if ok {
+		exec.running = true
+	}
+	handler := c.Exec
+	c.lock.Unlock()
+
+	if !ok {
+		return types.HijackedResponse{}, errdefs.NotFound(fmt.Errorf("No such exec instance: %s", execID))
+	}
+
+	result := ExecResult{
+		Stderr:   fmt.Sprintf("OCI runtime exec failed: exec: %q: executable file not found in $PATH\n", exec.cmd[0]),
+		ExitCode: 126,
+	}
+	if handler != nil {
+		result = handler(exec.containerID, exec.cmd, exec.env)
+	}
+
+	c.lock.Lock()
+	exec.running = false
+	exec.exitCode = result.ExitCode
+	c.lock.Unlock()
+
+	var output bytes.Buffer
+	stdcopy.NewStdWriter(&output, stdcopy.Stdout).Write([]byte(result.Stdout))
+	stdcopy.NewStdWriter(&output, stdcopy.Stderr).Write([]byte(result.Stderr))
+
+	// The output is fully buffered, so the connection is only needed to
+	// satisfy HijackedResponse.Close.
+	conn, peer := net.Pipe()
+	peer.Close()
+	return types.HijackedResponse{
+		Conn:   conn,
+		Reader: bufio.NewReader(&output),
+	}, nil
+}
+
+// ContainerExecInspect returns the exit code of the command.
+func (c *Client) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	exec, ok := c.execs[execID]
+	if !ok {
+		return types.ContainerExecInspect{}, errdefs.NotFound(fmt.Errorf("No such exec instance: %s", execID))
+	}
+	return types.ContainerExecInspect{
+		ExecID:      exec.id,
+		ContainerID: exec.containerID,
+		Running:     exec.running,
+		ExitCode:    exec.exitCode,
+	}, nil
+}
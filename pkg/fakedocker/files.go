@@ -0,0 +1,171 @@
+package fakedocker
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+)
+
+// file is a regular file or directory in an image, container, or volume.
+type file struct {
+	mode    os.FileMode
+	content []byte
+	modTime time.Time
+}
+
+// fileMap maps absolute paths to files. Directories are implied by the paths
+// of the files within them, so only empty directories need to be stored.
+type fileMap map[string]file
+
+func newDir() file {
+	return file{mode: os.ModeDir | 0755, modTime: time.Now()}
+}
+
+func (files fileMap) copy() fileMap {
+	copied := fileMap{}
+	for path, f := range files {
+		copied[path] = f
+	}
+	return copied
+}
+
+// size returns the total size of the files.
+func (files fileMap) size() (size int64) {
+	for _, f := range files {
+		size += int64(len(f.content))
+	}
+	return size
+}
+
+// stat returns the file or directory at the path.
+func (files fileMap) stat(p string) (file, bool) {
+	p = cleanPath(p)
+	if f, ok := files[p]; ok {
+		return f, true
+	}
+	if p == "/" {
+		return newDir(), true
+	}
+
+	prefix := p + "/"
+	for name := range files {
+		if strings.HasPrefix(name, prefix) {
+			return newDir(), true
+		}
+	}
+	return file{}, false
+}
+
+// read returns the contents of the regular file at the path.
+func (files fileMap) read(p string) ([]byte, error) {
+	f, ok := files.stat(p)
+	if !ok {
+		return nil, errdefs.NotFound(fmt.Errorf("no such file or directory: %s", p))
+	}
+	if f.mode.IsDir() {
+		return nil, errdefs.InvalidParameter(fmt.Errorf("%s is a directory", p))
+	}
+	return f.content, nil
+}
+
+// archive writes a tarball of the file or directory at the path in the
+// format returned by `docker cp`. The entries are named relative to the
+// parent directory of the path, so copying /var/lib/data creates entries
+// such as data/ and data/file.
+func (files fileMap) archive(w io.Writer, p string) error {
+	p = cleanPath(p)
+	root, ok := files.stat(p)
+	if !ok {
+		return errdefs.NotFound(fmt.Errorf("no such file or directory: %s", p))
+	}
+
+	base := path.Base(p)
+	entries := map[string]file{base: root}
+	if root.mode.IsDir() {
+		prefix := strings.TrimSuffix(p, "/") + "/"
+		for name, f := range files {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			rel := strings.TrimPrefix(name, prefix)
+			entries[path.Join(base, rel)] = f
+			for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+				if _, ok := entries[path.Join(base, dir)]; !ok {
+					entries[path.Join(base, dir)] = newDir()
+				}
+			}
+		}
+	}
+
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		f := entries[name]
+		header := &tar.Header{
+			Name:     name,
+			Mode:     int64(f.mode.Perm()),
+			ModTime:  f.modTime,
+			Typeflag: tar.TypeReg,
+			Size:     int64(len(f.content)),
+		}
+		if f.mode.IsDir() {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// extractTar calls write for each regular file and directory in the
+// tarball, with its path within the dest directory. Other types of files are
+// ignored.
+func extractTar(r io.Reader, dest string, write func(path string, f file)) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errdefs.InvalidParameter(fmt.Errorf("read tar: %w", err))
+		}
+
+		f := file{
+			mode:    os.FileMode(header.Mode).Perm(),
+			modTime: header.ModTime,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			f.mode |= os.ModeDir
+		case tar.TypeReg, tar.TypeRegA:
+			f.content, err = ioutil.ReadAll(tr)
+			if err != nil {
+				return errdefs.InvalidParameter(fmt.Errorf("read %s: %w", header.Name, err))
+			}
+		default:
+			continue
+		}
+		write(cleanPath(path.Join(dest, header.Name)), f)
+	}
+}
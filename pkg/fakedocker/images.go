@@ -0,0 +1,314 @@
+package fakedocker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	imageTypes "github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stringid"
+)
+
+// image is a single layer. Its files are the contents of its entire
+// filesystem, including the files inherited from its parent.
+type image struct {
+	id        string
+	seq       int
+	parent    string
+	config    containerTypes.Config
+	files     fileMap
+	created   time.Time
+	createdBy string
+
+	// size is the size of the files that the layer added or changed.
+	size int64
+}
+
+// addImage assigns an ID to the image, and adds it to the client.
+func (c *Client) addImage(img *image) *image {
+	img.id = "sha256:" + c.newID()
+	img.seq = c.nextID
+	img.created = time.Now()
+	c.images[img.id] = img
+	return img
+}
+
+// tag points the normalized ref at the image, and removes it from any image
+// that it previously pointed at.
+func (c *Client) tag(ref, imageID string) {
+	c.tags[ref] = imageID
+}
+
+func (c *Client) tagsOf(imageID string) []string {
+	var tags []string
+	for ref, id := range c.tags {
+		if id == imageID {
+			tags = append(tags, ref)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (c *Client) hasChildren(imageID string) bool {
+	for _, img := range c.images {
+		if img.parent == imageID {
+			return true
+		}
+	}
+	return false
+}
+
+// imageUser returns a container that was created from the image, preferring
+// running containers.
+func (c *Client) imageUser(imageID string) *container {
+	var user *container
+	for _, ctr := range c.sortedContainers() {
+		if ctr.imageID != imageID {
+			continue
+		}
+		if ctr.running {
+			return ctr
+		}
+		if user == nil {
+			user = ctr
+		}
+	}
+	return user
+}
+
+// virtualSize returns the size of all the layers in the image.
+func (c *Client) virtualSize(img *image) (size int64) {
+	for ; img != nil; img = c.images[img.parent] {
+		size += img.size
+	}
+	return size
+}
+
+// ImageList lists the images. Intermediate images are only included if All
+// is set. The label and dangling filters are supported.
+func (c *Client) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := options.Filters.Validate(map[string]bool{"label": true, "dangling": true})
+	if err != nil {
+		return nil, errdefs.InvalidParameter(err)
+	}
+
+	var images []*image
+	for _, img := range c.images {
+		images = append(images, img)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].seq > images[j].seq
+	})
+
+	var summaries []types.ImageSummary
+	for _, img := range images {
+		tags := c.tagsOf(img.id)
+		dangling := len(tags) == 0 && !c.hasChildren(img.id)
+		switch {
+		case !options.All && len(tags) == 0 && !dangling:
+			continue
+		case options.Filters.Contains("dangling") && !options.Filters.ExactMatch("dangling", fmt.Sprint(dangling)):
+			continue
+		case !options.Filters.MatchKVList("label", img.config.Labels):
+			continue
+		}
+
+		if len(tags) == 0 {
+			tags = []string{"<none>:<none>"}
+		}
+		summaries = append(summaries, types.ImageSummary{
+			ID:          img.id,
+			ParentID:    img.parent,
+			RepoTags:    tags,
+			Created:     img.created.Unix(),
+			Size:        c.virtualSize(img),
+			VirtualSize: c.virtualSize(img),
+			SharedSize:  -1,
+			Labels:      copyLabels(img.config.Labels),
+			Containers:  -1,
+		})
+	}
+	return summaries, nil
+}
+
+// ImageHistory returns the layers of the image, from newest to oldest.
+func (c *Client) ImageHistory(ctx context.Context, imageRef string) ([]imageTypes.HistoryResponseItem, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	img, err := c.findImage(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []imageTypes.HistoryResponseItem
+	for ; img != nil; img = c.images[img.parent] {
+		history = append(history, imageTypes.HistoryResponseItem{
+			ID:        img.id,
+			Created:   img.created.Unix(),
+			CreatedBy: img.createdBy,
+			Tags:      c.tagsOf(img.id),
+			Size:      img.size,
+		})
+	}
+	return history, nil
+}
+
+// ImageInspectWithRaw returns the image's metadata.
+func (c *Client) ImageInspectWithRaw(ctx context.Context, imageRef string) (types.ImageInspect, []byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	img, err := c.findImage(imageRef)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+
+	config := copyConfig(img.config)
+	inspect := types.ImageInspect{
+		ID:              img.id,
+		RepoTags:        c.tagsOf(img.id),
+		Parent:          img.parent,
+		Created:         img.created.Format(time.RFC3339Nano),
+		ContainerConfig: &containerTypes.Config{},
+		DockerVersion:   "fakedocker",
+		Config:          &config,
+		Architecture:    "amd64",
+		Os:              "linux",
+		Size:            c.virtualSize(img),
+		VirtualSize:     c.virtualSize(img),
+	}
+	raw, err := json.Marshal(inspect)
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	return inspect, raw, nil
+}
+
+// ImagePull succeeds for images that already exist. The fake can't download
+// images, so pulling any other image fails.
+func (c *Client) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := c.findImage(ref); err != nil {
+		return nil, errdefs.NotFound(fmt.Errorf("pull access denied for %s, repository does not exist", ref))
+	}
+
+	var stream bytes.Buffer
+	json.NewEncoder(&stream).Encode(jsonmessage.JSONMessage{
+		Status: "Status: Image is up to date for " + normalizeRef(ref),
+	})
+	return ioutil.NopCloser(&stream), nil
+}
+
+// ImageRemove removes an image, following the rules of `docker rmi`.
+// Removing a name only untags the image unless it's the image's last name.
+// Images with children, or that are used by containers, can't be removed.
+func (c *Client) ImageRemove(ctx context.Context, imageRef string, options types.ImageRemoveOptions) (
+	[]types.ImageDeleteResponseItem, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	img, err := c.findImage(imageRef)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := c.tagsOf(img.id)
+	ref := normalizeRef(imageRef)
+	if c.tags[ref] != img.id {
+		if len(tags) > 1 && !options.Force {
+			return nil, errdefs.Conflict(fmt.Errorf("unable to delete %s (must be forced) - "+
+				"image is referenced in multiple repositories", stringid.TruncateID(img.id)))
+		}
+		return c.deleteImage(img, options.Force, options.PruneChildren, false)
+	}
+
+	if len(tags) == 1 && !options.Force {
+		if user := c.imageUser(img.id); user != nil {
+			return nil, errdefs.Conflict(fmt.Errorf("unable to remove repository reference %q (must force) - "+
+				"container %s is using its referenced image %s",
+				imageRef, stringid.TruncateID(user.id), stringid.TruncateID(img.id)))
+		}
+	}
+
+	delete(c.tags, ref)
+	deleted := []types.ImageDeleteResponseItem{{Untagged: ref}}
+	if len(tags) > 1 {
+		return deleted, nil
+	}
+
+	// Removing the last name also removes the image, unless something
+	// depends on it.
+	items, err := c.deleteImage(img, options.Force, options.PruneChildren, true)
+	return append(deleted, items...), err
+}
+
+// deleteImage removes the image and its names. If prune is set, its
+// untagged parents that nothing else depends on are also removed. If quiet
+// is set, images that can't be removed are silently left as is.
+func (c *Client) deleteImage(img *image, force, prune, quiet bool) ([]types.ImageDeleteResponseItem, error) {
+	var conflict error
+	user := c.imageUser(img.id)
+	switch {
+	case c.hasChildren(img.id):
+		conflict = fmt.Errorf("unable to delete %s (cannot be forced) - image has dependent child images",
+			stringid.TruncateID(img.id))
+	case user != nil && user.running:
+		conflict = fmt.Errorf("unable to delete %s (cannot be forced) - image is being used by "+
+			"running container %s", stringid.TruncateID(img.id), stringid.TruncateID(user.id))
+	case user != nil && !force:
+		conflict = fmt.Errorf("unable to delete %s (must be forced) - image is being used by "+
+			"stopped container %s", stringid.TruncateID(img.id), stringid.TruncateID(user.id))
+	}
+	if conflict != nil {
+		if quiet {
+			return nil, nil
+		}
+		return nil, errdefs.Conflict(conflict)
+	}
+
+	var deleted []types.ImageDeleteResponseItem
+	for _, ref := range c.tagsOf(img.id) {
+		delete(c.tags, ref)
+		deleted = append(deleted, types.ImageDeleteResponseItem{Untagged: ref})
+	}
+	delete(c.images, img.id)
+	deleted = append(deleted, types.ImageDeleteResponseItem{Deleted: img.id})
+
+	if parent, ok := c.images[img.parent]; ok && prune && len(c.tagsOf(parent.id)) == 0 {
+		items, _ := c.deleteImage(parent, false, true, true)
+		deleted = append(deleted, items...)
+	}
+	return deleted, nil
+}
+
+func copyConfig(config containerTypes.Config) containerTypes.Config {
+	config.Labels = copyLabels(config.Labels)
+	config.Env = append([]string(nil), config.Env...)
+	config.Entrypoint = append([]string(nil), config.Entrypoint...)
+	config.Cmd = append([]string(nil), config.Cmd...)
+	return config
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	copied := map[string]string{}
+	for k, v := range labels {
+		copied[k] = v
+	}
+	return copied
+}
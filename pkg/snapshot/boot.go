@@ -0,0 +1,150 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+// ReadyTimeout is how long Boot and Replace wait for containers to become
+// ready.
+const ReadyTimeout = 5 * time.Minute
+
+// BootOptions overrides parts of the snapshot's run configuration when
+// booting it.
+type BootOptions struct {
+	// Name is the name of the new container. Docker picks a random name if
+	// it's empty.
+	Name string
+
+	// Ports overrides the ports published by the snapshot's run
+	// configuration. The recorded ports are used if it's nil.
+	Ports []PortBinding
+}
+
+// BootResult describes a container booted from a snapshot.
+type BootResult struct {
+	ContainerID string
+
+	// Notices describe the parts of the snapshot's run configuration that
+	// couldn't be restored, such as networks that have been removed.
+	Notices []string
+}
+
+// Boot creates and starts a new container from the snapshot, and waits for
+// it to become ready. If the snapshot recorded the run configuration of its
+// source container, the new container is configured the same way. If the
+// container fails to start or become ready, it's removed.
+func Boot(ctx context.Context, dockerClient DockerClient, snap *Snapshot, opts BootOptions,
+	logs io.Writer) (BootResult, error) {
+	var result BootResult
+	image := snap.ImageID
+	if len(snap.ImageNames) > 0 {
+		image = snap.ImageNames[0]
+	}
+
+	containerSpec := &container.Config{Image: image}
+	hostConfig := &container.HostConfig{}
+	networkingConfig := &network.NetworkingConfig{}
+	var extraNetworks []Network
+	if runConfig := snap.RunConfig; runConfig != nil {
+		containerSpec.Env = runConfig.Env
+		containerSpec.Cmd = runConfig.Cmd
+		hostConfig.RestartPolicy = container.RestartPolicy{
+			Name:              runConfig.RestartPolicy,
+			MaximumRetryCount: runConfig.MaxRetries,
+		}
+
+		ports := runConfig.Ports
+		if opts.Ports != nil {
+			ports = opts.Ports
+		}
+		containerSpec.ExposedPorts = nat.PortSet{}
+		hostConfig.PortBindings = nat.PortMap{}
+		for _, port := range ports {
+			containerPort := nat.Port(port.ContainerPort)
+			containerSpec.ExposedPorts[containerPort] = struct{}{}
+			hostConfig.PortBindings[containerPort] = append(hostConfig.PortBindings[containerPort],
+				nat.PortBinding{HostIP: port.HostIP, HostPort: port.HostPort})
+		}
+
+		networkMode := container.NetworkMode(runConfig.NetworkMode)
+		if networkMode.IsHost() || networkMode.IsNone() || networkMode.IsContainer() {
+			hostConfig.NetworkMode = networkMode
+		} else {
+			// Skip networks that have been removed since the snapshot was
+			// created, rather than failing to boot.
+			var networks []Network
+			for _, network := range runConfig.Networks {
+				_, err := dockerClient.NetworkInspect(ctx, network.Name, types.NetworkInspectOptions{})
+				if err != nil {
+					result.Notices = append(result.Notices, fmt.Sprintf("Skipped network %s: %s", network.Name, err))
+					continue
+				}
+				networks = append(networks, network)
+			}
+
+			// Containers can only be created with a single network, so the
+			// rest are connected before the container is started.
+			if len(networks) > 0 {
+				hostConfig.NetworkMode = container.NetworkMode(networks[0].Name)
+				networkingConfig.EndpointsConfig = map[string]*network.EndpointSettings{
+					networks[0].Name: endpointSettings(networks[0]),
+				}
+				extraNetworks = networks[1:]
+			}
+		}
+	}
+
+	createdContainer, err := dockerClient.ContainerCreate(ctx, containerSpec, hostConfig, networkingConfig, opts.Name)
+	if err != nil {
+		return result, fmt.Errorf("create container: %w", err)
+	}
+	result.ContainerID = createdContainer.ID
+
+	// Remove the container if it fails to start so that its name is freed
+	// up for the next attempt.
+	removeContainer := func() {
+		cleanupCtx, cancel := CleanupContext()
+		defer cancel()
+		dockerClient.ContainerRemove(cleanupCtx, createdContainer.ID, types.ContainerRemoveOptions{Force: true})
+	}
+
+	for _, network := range extraNetworks {
+		err := dockerClient.NetworkConnect(ctx, network.Name, createdContainer.ID, endpointSettings(network))
+		if err != nil {
+			removeContainer()
+			return result, fmt.Errorf("connect to network %s: %w", network.Name, err)
+		}
+	}
+
+	err = dockerClient.ContainerStart(ctx, createdContainer.ID, types.ContainerStartOptions{})
+	if err != nil {
+		removeContainer()
+		return result, fmt.Errorf("start container: %w", err)
+	}
+
+	fmt.Fprintln(logs, "Waiting for the container to become ready..")
+	readyCtx, cancel := context.WithTimeout(ctx, ReadyTimeout)
+	defer cancel()
+	if err := WaitReady(readyCtx, dockerClient, createdContainer.ID, snap.ReadinessProbe, logs); err != nil {
+		removeContainer()
+		return result, fmt.Errorf("container failed to become ready: %w", err)
+	}
+	return result, nil
+}
+
+// endpointSettings returns the settings for connecting a container to the
+// network. Aliases are only supported by user defined networks.
+func endpointSettings(net Network) *network.EndpointSettings {
+	if !container.NetworkMode(net.Name).IsUserDefined() {
+		return &network.EndpointSettings{}
+	}
+	return &network.EndpointSettings{Aliases: net.Aliases}
+}
@@ -0,0 +1,36 @@
+package snapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+func TestBootNotReady(t *testing.T) {
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	snap := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Postgres Snapshot")
+
+	db.notReady = true
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := Boot(ctx, client, snap, BootOptions{Name: "restored"}, ioutil.Discard)
+	if err == nil {
+		t.Fatal("boot succeeded even though the container never became ready")
+	}
+
+	// The container is removed so that booting again with the same name
+	// works.
+	if _, err := client.ContainerInspect(context.Background(), result.ContainerID); err == nil {
+		t.Errorf("container that failed to become ready wasn't removed")
+	}
+
+	db.notReady = false
+	if _, err := Boot(context.Background(), client, snap, BootOptions{Name: "restored"}, ioutil.Discard); err != nil {
+		t.Errorf("boot again: %s", err)
+	}
+}
@@ -0,0 +1,131 @@
+package snapshot
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Databases are the databases that run in a container.
+type Databases struct {
+	Postgres bool
+	Mongo    bool
+	MySQL    bool
+}
+
+// Any returns whether the container runs any database.
+func (dbs Databases) Any() bool {
+	return dbs.Postgres || dbs.Mongo || dbs.MySQL
+}
+
+// DetectDatabases guesses the databases that run in the container from its
+// processes.
+func DetectDatabases(ctx context.Context, dockerClient DockerClient, container types.ContainerJSON) Databases {
+	var processes []string
+	if container.State != nil && container.State.Running {
+		topResp, err := dockerClient.ContainerTop(ctx, container.ID, []string{"-eo", "pid,comm"})
+		if err == nil {
+			for _, process := range topResp.Processes {
+				if len(process) == 2 {
+					processes = append(processes, process[1])
+				}
+			}
+		}
+	}
+
+	// Stopped containers don't have any processes, so guess the database
+	// from the command the container runs instead.
+	if processes == nil {
+		processes = append(processes, filepath.Base(container.Path))
+		if len(container.Args) > 0 {
+			processes = append(processes, filepath.Base(container.Args[0]))
+		}
+	}
+
+	var dbs Databases
+	for _, process := range processes {
+		switch {
+		case strings.Contains(process, "postgres"):
+			dbs.Postgres = true
+		case strings.Contains(process, "mongo"):
+			dbs.Mongo = true
+		case strings.Contains(process, "mysql"):
+			dbs.MySQL = true
+		}
+	}
+	return dbs
+}
+
+// SelectOptions controls which snapshotter NewSnapshotter selects.
+type SelectOptions struct {
+	// DBUser is the user that dumps Postgres databases. It defaults to
+	// DefaultPostgresUser.
+	DBUser string
+
+	// DumpStopped dumps the databases of stopped containers by booting a
+	// temporary copy of them. Otherwise, stopped containers are snapshotted
+	// generically.
+	DumpStopped bool
+
+	// ForceGeneric disables database aware snapshots.
+	ForceGeneric bool
+}
+
+// NewSnapshotter returns the database aware snapshotter for the container's
+// databases, or the generic snapshotter if there isn't one.
+func NewSnapshotter(dockerClient DockerClient, container types.ContainerJSON, dbs Databases,
+	opts SelectOptions) Snapshotter {
+	running := container.State != nil && container.State.Running
+	dbAware := !opts.ForceGeneric && (running || opts.DumpStopped)
+	switch {
+	case dbAware && dbs.Postgres:
+		dbUser := opts.DBUser
+		if dbUser == "" {
+			dbUser = DefaultPostgresUser(container)
+		}
+		return NewPostgres(dockerClient, dbUser)
+	case dbAware && dbs.Mongo:
+		return NewMongo(dockerClient)
+	case dbAware && dbs.MySQL:
+		return NewMySQL(dockerClient)
+	default:
+		return NewGeneric(dockerClient)
+	}
+}
+
+// DefaultPostgresUser returns the user that should be used to dump the
+// container's Postgres database.
+func DefaultPostgresUser(container types.ContainerJSON) string {
+	if container.Config != nil {
+		for _, env := range container.Config.Env {
+			if strings.HasPrefix(env, "POSTGRES_USER=") {
+				return strings.TrimPrefix(env, "POSTGRES_USER=")
+			}
+		}
+	}
+	return "postgres"
+}
+
+// CreateWithFallback snapshots the container with the snapshotter. If a
+// database aware snapshot fails, onFallback is called with the error, and a
+// generic snapshot is created instead.
+func CreateWithFallback(ctx context.Context, dockerClient DockerClient, snapshotter Snapshotter,
+	container types.ContainerJSON, opts CreateOptions, onFallback func(error)) error {
+	err := snapshotter.Create(ctx, container, opts)
+	if err == nil {
+		return nil
+	}
+
+	// Don't try snapshotting again if we already tried the generic snapshot.
+	if _, ok := snapshotter.(*Generic); ok {
+		return err
+	}
+
+	if onFallback != nil {
+		onFallback(err)
+	}
+	opts.Fallback = true
+	return NewGeneric(dockerClient).Create(ctx, container, opts)
+}
@@ -10,12 +10,11 @@ import (
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
 	"github.com/pmezard/go-difflib/difflib"
 )
 
 // Diff returns the diff between the dumps of the given snapshots.
-func Diff(ctx context.Context, dockerClient *client.Client, x, y *Snapshot) (string, error) {
+func Diff(ctx context.Context, dockerClient DockerClient, x, y *Snapshot) (string, error) {
 	if x.DumpPath == "" || y.DumpPath == "" {
 		return "", errors.New("can't diff generic snapshots")
 	}
@@ -40,30 +39,47 @@ func Diff(ctx context.Context, dockerClient *client.Client, x, y *Snapshot) (str
 	return difflib.GetUnifiedDiffString(diff)
 }
 
-func getFile(ctx context.Context, dockerClient *client.Client, image, path string) ([]byte, error) {
-	containerID, err := dockerClient.ContainerCreate(ctx, &container.Config{Image: image}, nil, nil, "")
+// copyFromImage returns a tarball of the given path within the image. The
+// returned cleanup function must be called once the tarball is no longer
+// needed.
+func copyFromImage(ctx context.Context, dockerClient DockerClient, image, path string) (
+	io.ReadCloser, func(), error) {
+	containerID, err := dockerClient.ContainerCreate(ctx, &container.Config{
+		Image:  image,
+		Labels: helperLabels("copy"),
+	}, nil, nil, "")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	defer dockerClient.ContainerRemove(ctx, containerID.ID, types.ContainerRemoveOptions{
-		RemoveVolumes: true,
-		RemoveLinks:   true,
-		Force:         true,
-	})
+	cleanup := func() {
+		dockerClient.ContainerRemove(ctx, containerID.ID, types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			RemoveLinks:   true,
+			Force:         true,
+		})
+	}
 
 	tarball, _, err := dockerClient.CopyFromContainer(ctx, containerID.ID, path)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return tarball, cleanup, nil
+}
+
+func getFile(ctx context.Context, dockerClient DockerClient, image, path string) ([]byte, error) {
+	tarball, cleanup, err := copyFromImage(ctx, dockerClient, image, path)
 	if err != nil {
 		return nil, err
 	}
+	defer cleanup()
 	defer tarball.Close()
 
 	tr := tar.NewReader(tarball)
 	for {
 		header, err := tr.Next()
 		switch {
-		case header == nil:
-			continue
 		case err == io.EOF:
 			return nil, errors.New("missing file")
 		case err != nil:
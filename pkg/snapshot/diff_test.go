@@ -0,0 +1,64 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\nINSERT INTO users VALUES ('kevin');\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	before := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Before")
+
+	db.dump = "CREATE TABLE users;\nINSERT INTO users VALUES ('luise');\n"
+	after := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "After")
+
+	diff, err := Diff(ctx, client, before, after)
+	if err != nil {
+		t.Fatalf("diff: %s", err)
+	}
+
+	// difflib.SplitLines treats the final newline as the start of an empty
+	// last line.
+	exp := "--- Before\n" +
+		"+++ After\n" +
+		"@@ -1,3 +1,3 @@\n" +
+		" CREATE TABLE users;\n" +
+		"-INSERT INTO users VALUES ('kevin');\n" +
+		"+INSERT INTO users VALUES ('luise');\n" +
+		" \n"
+	if diff != exp {
+		t.Errorf("unexpected diff:\n%s\nexpected:\n%s", diff, exp)
+	}
+	assertNoHelperContainers(t, client)
+}
+
+func TestDiffGeneric(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDocker(&postgresDB{})
+	container := runContainer(t, client, "app", &containerTypes.Config{Image: "app"}, nil)
+	x := createSnapshot(t, client, NewGeneric(client), container, "X")
+	y := createSnapshot(t, client, NewGeneric(client), container, "Y")
+
+	if _, err := Diff(ctx, client, x, y); err == nil {
+		t.Errorf("generic snapshots shouldn't be diffable")
+	}
+}
+
+func TestGetFileMissing(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	snap := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Snapshot")
+
+	// The directory exists, but isn't a file with the requested name.
+	if _, err := getFile(ctx, client, snap.ImageID, "/docker-entrypoint-initdb.d"); err == nil {
+		t.Errorf("getting a directory succeeded")
+	}
+	assertNoHelperContainers(t, client)
+}
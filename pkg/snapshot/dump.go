@@ -0,0 +1,58 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+// startDumpContainer returns the ID of a running container that the
+// container's database can be dumped from.
+//
+// Databases can only be dumped from running containers, so if the container
+// is stopped, a temporary copy of it is booted with the same volumes. Note
+// that the database may modify the volumes when it boots, for example to
+// recover from a crash. The returned function removes the temporary copy,
+// even if ctx was cancelled.
+func startDumpContainer(ctx context.Context, dockerClient DockerClient, container types.ContainerJSON,
+	probe []string) (string, func(), error) {
+	if container.State == nil || container.State.Running {
+		return container.ID, func() {}, nil
+	}
+
+	// Don't copy the labels so that tools such as docker-compose don't
+	// mistake the temporary container for the original.
+	config := *container.Config
+	config.Image = container.Image
+	config.Labels = helperLabels("dump")
+	config.ExposedPorts = nil
+	hostConfig := &containerTypes.HostConfig{
+		VolumesFrom: []string{container.ID},
+	}
+
+	createdContainer, err := dockerClient.ContainerCreate(ctx, &config, hostConfig, nil, "")
+	if err != nil {
+		return "", nil, fmt.Errorf("create temporary container: %w", err)
+	}
+
+	// Remove the temporary container even if the snapshot was cancelled.
+	cleanup := func() {
+		ctx, cancel := CleanupContext()
+		defer cancel()
+		dockerClient.ContainerRemove(ctx, createdContainer.ID, types.ContainerRemoveOptions{Force: true})
+	}
+
+	if err := dockerClient.ContainerStart(ctx, createdContainer.ID, types.ContainerStartOptions{}); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("start temporary container: %w", err)
+	}
+
+	if err := WaitReady(ctx, dockerClient, createdContainer.ID, probe, ioutil.Discard); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("temporary container failed to become ready: %w", err)
+	}
+	return createdContainer.ID, cleanup, nil
+}
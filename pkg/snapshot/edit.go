@@ -0,0 +1,56 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// EditOptions contains the user editable metadata of a snapshot.
+type EditOptions struct {
+	Title       string
+	Description string
+	Tags        []string
+
+	// Pinned protects the snapshot from being removed or pruned.
+	Pinned bool
+}
+
+// Edit changes the title, description, tags, and pinning of a snapshot. The snapshot
+// is replaced by a new image with the updated labels, and the original image
+// is hidden from List.
+func Edit(ctx context.Context, dockerClient DockerClient, snap *Snapshot, opts EditOptions) error {
+	if snap.BaseImage {
+		return errors.New("can't edit a base image")
+	}
+
+	if opts.Title == "" {
+		return errors.New("title is required")
+	}
+
+	tagsJSON, err := json.Marshal(opts.Tags)
+	if err != nil {
+		return fmt.Errorf("marshal tags: %w", err)
+	}
+
+	return relabel(ctx, dockerClient, snap, map[string]string{
+		TitleLabel:       opts.Title,
+		DescriptionLabel: opts.Description,
+		TagsLabel:        string(tagsJSON),
+		PinnedLabel:      strconv.FormatBool(opts.Pinned),
+	})
+}
+
+// SetPinned pins or unpins a snapshot. Pinned snapshots can only be removed
+// or pruned when forced.
+func SetPinned(ctx context.Context, dockerClient DockerClient, snap *Snapshot, pinned bool) error {
+	if snap.BaseImage {
+		return errors.New("can't pin a base image")
+	}
+
+	return relabel(ctx, dockerClient, snap, map[string]string{
+		PinnedLabel: strconv.FormatBool(pinned),
+	})
+}
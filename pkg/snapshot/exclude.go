@@ -0,0 +1,120 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ParseExcludePatterns parses a comma or newline separated list of exclude
+// patterns, such as the value of ExcludeLabel.
+//
+// Patterns follow the syntax of filepath.Match. Like .gitignore, patterns
+// without a slash match files and directories with that name anywhere in
+// the mount, such as `node_modules` or `*.log`. Patterns with a leading or
+// middle slash match paths relative to the root of the mount, such as
+// `cache/*` or `/tmp`. Everything within an excluded directory is excluded as
+// well.
+func ParseExcludePatterns(value string) []string {
+	var patterns []string
+	for _, line := range strings.Split(value, "\n") {
+		for _, pattern := range strings.Split(line, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// ValidateExcludePatterns returns an error if any of the patterns are
+// malformed.
+func ValidateExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, ",") {
+			return fmt.Errorf("exclude pattern %q can't contain a comma", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("malformed exclude pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// mergeExcludePatterns combines the lists of patterns, dropping duplicates.
+func mergeExcludePatterns(lists ...[]string) []string {
+	var merged []string
+	seen := map[string]bool{}
+	for _, patterns := range lists {
+		for _, pattern := range patterns {
+			if !seen[pattern] {
+				seen[pattern] = true
+				merged = append(merged, pattern)
+			}
+		}
+	}
+	return merged
+}
+
+// isExcluded returns whether the path, relative to the root of the mount,
+// matches any of the patterns.
+func isExcluded(patterns []string, path string) bool {
+	parts := strings.Split(path, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		for _, pattern := range patterns {
+			// Like .gitignore, a trailing slash doesn't anchor the pattern
+			// to the root.
+			anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+			pattern = strings.Trim(pattern, "/")
+
+			name := prefix
+			if !anchored {
+				name = parts[i]
+			}
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterTar copies the tarball of a mount from Docker, skipping the excluded
+// files. The tarball's top level directory is the mount itself, so it's
+// ignored when matching the patterns. Hardlinks to excluded files are
+// skipped as well, since their contents are stored with the original file.
+func filterTar(w io.Writer, r io.Reader, patterns []string) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	excludedFiles := map[string]bool{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.Trim(strings.TrimPrefix(header.Name, "./"), "/")
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) == 2 && isExcluded(patterns, parts[1]) {
+			excludedFiles[header.Name] = true
+			continue
+		}
+		if header.Typeflag == tar.TypeLink && excludedFiles[header.Linkname] {
+			continue
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("write %s: %w", header.Name, err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("copy %s: %w", header.Name, err)
+		}
+	}
+	return tw.Close()
+}
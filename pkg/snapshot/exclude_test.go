@@ -0,0 +1,114 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestIsExcluded(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		exp      bool
+	}{
+		// Patterns without a slash match names anywhere in the mount.
+		{[]string{"node_modules"}, "node_modules", true},
+		{[]string{"node_modules"}, "app/node_modules/react/index.js", true},
+		{[]string{"*.log"}, "logs/server.log", true},
+		{[]string{"*.log"}, "server.log.gz", false},
+
+		// Patterns with a slash match paths relative to the root.
+		{[]string{"cache/*"}, "cache/entry", true},
+		{[]string{"cache/*"}, "cache/dir/entry", true},
+		{[]string{"cache/*"}, "app/cache/entry", false},
+		{[]string{"/tmp/"}, "tmp/file", true},
+		{[]string{"/tmp/"}, "app/tmp/file", false},
+		{[]string{"tmp/"}, "app/tmp/file", true},
+
+		{[]string{"cache"}, "cached", false},
+		{nil, "data", false},
+		{[]string{"*.log", "tmp"}, "tmp", true},
+	}
+	for _, test := range tests {
+		if actual := isExcluded(test.patterns, test.path); actual != test.exp {
+			t.Errorf("isExcluded(%v, %q) = %t, expected %t", test.patterns, test.path, actual, test.exp)
+		}
+	}
+}
+
+func TestFilterTar(t *testing.T) {
+	dir := func(name string) tar.Header {
+		return tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}
+	}
+	file := func(name string) tar.Header {
+		return tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+	}
+	link := func(name, target string) tar.Header {
+		return tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}
+	}
+
+	tests := []struct {
+		name     string
+		headers  []tar.Header
+		patterns []string
+		exp      []string
+	}{
+		{
+			name:     "top level directory isn't matched",
+			headers:  []tar.Header{dir("cache/"), file("cache/entry")},
+			patterns: []string{"cache"},
+			exp:      []string{"cache/", "cache/entry"},
+		},
+		{
+			name: "excluded directory",
+			headers: []tar.Header{dir("data/"), dir("data/tmp/"), file("data/tmp/a"),
+				file("data/keep")},
+			patterns: []string{"tmp"},
+			exp:      []string{"data/", "data/keep"},
+		},
+		{
+			name: "hardlink to excluded file",
+			headers: []tar.Header{dir("data/"), file("data/debug.log"), link("data/latest", "data/debug.log"),
+				file("data/keep"), link("data/keep-link", "data/keep")},
+			patterns: []string{"*.log"},
+			exp:      []string{"data/", "data/keep", "data/keep-link"},
+		},
+	}
+	for _, test := range tests {
+		var in bytes.Buffer
+		tw := tar.NewWriter(&in)
+		for _, header := range test.headers {
+			header := header
+			if err := tw.WriteHeader(&header); err != nil {
+				t.Fatalf("%s: write header: %s", test.name, err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("%s: close: %s", test.name, err)
+		}
+
+		var out bytes.Buffer
+		if err := filterTar(&out, &in, test.patterns); err != nil {
+			t.Fatalf("%s: filter: %s", test.name, err)
+		}
+
+		var names []string
+		tr := tar.NewReader(&out)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: read: %s", test.name, err)
+			}
+			names = append(names, header.Name)
+		}
+		if !reflect.DeepEqual(names, test.exp) {
+			t.Errorf("%s: got %v, expected %v", test.name, names, test.exp)
+		}
+	}
+}
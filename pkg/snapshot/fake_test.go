@@ -0,0 +1,124 @@
+package snapshot
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+
+	"github.com/kelda/dksnap/pkg/fakedocker"
+)
+
+var _ DockerClient = fakedocker.New()
+
+// postgresDB simulates the Postgres commands that dksnap runs in containers.
+// The database's contents are the dump returned by pg_dumpall.
+type postgresDB struct {
+	dump string
+
+	// failDump makes pg_dumpall fail.
+	failDump bool
+
+	// notReady makes pg_isready fail.
+	notReady bool
+
+	// dumpedFrom is the ID of the container that was last dumped, and
+	// dumpUser is the user that dumped it.
+	dumpedFrom string
+	dumpUser   string
+}
+
+func (db *postgresDB) exec(containerID string, cmd, env []string) fakedocker.ExecResult {
+	if cmd[0] == "pg_dumpall" {
+		db.dumpedFrom = containerID
+		db.dumpUser = cmd[len(cmd)-1]
+	}
+
+	switch {
+	case cmd[0] == "pg_dumpall" && db.failDump:
+		return fakedocker.ExecResult{Stderr: "connection refused", ExitCode: 2}
+	case cmd[0] == "pg_dumpall":
+		return fakedocker.ExecResult{Stdout: db.dump}
+	case cmd[0] == "pg_isready" && db.notReady:
+		return fakedocker.ExecResult{Stdout: "127.0.0.1:5432 - no response", ExitCode: 2}
+	case cmd[0] == "pg_isready":
+		return fakedocker.ExecResult{Stdout: "127.0.0.1:5432 - accepting connections"}
+	case strings.Join(cmd, " ") == "postgres --version":
+		return fakedocker.ExecResult{Stdout: "postgres (PostgreSQL) 12.1\n"}
+	default:
+		return fakedocker.ExecResult{Stderr: cmd[0] + ": not found", ExitCode: 127}
+	}
+}
+
+// newFakeDocker returns a fake Docker client with a Postgres image, and an
+// application image whose data is stored in /var/lib/app.
+func newFakeDocker(db *postgresDB) *fakedocker.Client {
+	client := fakedocker.New()
+	client.Exec = db.exec
+	client.AddImage("postgres:12", fakedocker.Image{
+		Env:        []string{"PGDATA=/var/lib/postgresql/data"},
+		Entrypoint: []string{"docker-entrypoint.sh"},
+		Cmd:        []string{"postgres"},
+		Files: map[string]string{
+			"/usr/local/bin/docker-entrypoint.sh": "#!/bin/bash\n",
+			"/usr/local/bin/postgres":             "postgres",
+		},
+	})
+	client.AddImage("app", fakedocker.Image{
+		Labels:     map[string]string{"maintainer": "kelda"},
+		Entrypoint: []string{"/app/server"},
+		Cmd:        []string{"--port", "8080"},
+		Files: map[string]string{
+			"/app/server": "server",
+		},
+	})
+	return client
+}
+
+// runContainer creates and starts a container, and returns its inspected
+// state.
+func runContainer(t *testing.T, client DockerClient, name string, config *containerTypes.Config,
+	hostConfig *containerTypes.HostConfig) types.ContainerJSON {
+	ctx := context.Background()
+	created, err := client.ContainerCreate(ctx, config, hostConfig, nil, name)
+	if err != nil {
+		t.Fatalf("create %s: %s", name, err)
+	}
+	if err := client.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatalf("start %s: %s", name, err)
+	}
+
+	container, err := client.ContainerInspect(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("inspect %s: %s", name, err)
+	}
+	return container
+}
+
+// createSnapshot snapshots the container with the snapshotter, and returns
+// the new snapshot.
+func createSnapshot(t *testing.T, client DockerClient, snapshotter Snapshotter, container types.ContainerJSON,
+	title string) *Snapshot {
+	ctx := context.Background()
+	imageName := ImageNameForTitle(title)
+	err := snapshotter.Create(ctx, container, CreateOptions{Title: title, ImageName: imageName})
+	if err != nil {
+		t.Fatalf("create snapshot %s: %s", title, err)
+	}
+	return findSnapshot(t, client, imageName)
+}
+
+func findSnapshot(t *testing.T, client DockerClient, ref string) *Snapshot {
+	snapshots, err := List(context.Background(), client)
+	if err != nil {
+		t.Fatalf("list snapshots: %s", err)
+	}
+
+	snap, err := Find(snapshots, ref)
+	if err != nil {
+		t.Fatalf("find snapshot: %s", err)
+	}
+	return snap
+}
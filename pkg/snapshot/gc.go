@@ -0,0 +1,171 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+)
+
+// GCResult lists the leftovers removed by GC.
+type GCResult struct {
+	Containers []string
+	Images     []string
+}
+
+// GC removes the helper containers and intermediate images that were left
+// behind by dksnap processes that were killed before they could clean up.
+// Intermediate images that snapshots are built on are kept.
+//
+// Helpers created within minAge are kept as well, since they may belong to a
+// dksnap process that's still running. Older helpers are also kept if they
+// were created by a dksnap process on this host that's still running.
+func GC(ctx context.Context, dockerClient DockerClient, minAge time.Duration) (GCResult, error) {
+	var result GCResult
+	cutoff := time.Now().Add(-minAge)
+	helperFilter := filters.NewArgs(filters.Arg("label", HelperLabel))
+
+	containers, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: helperFilter,
+	})
+	if err != nil {
+		return result, fmt.Errorf("list containers: %w", err)
+	}
+
+	for _, container := range containers {
+		// Containers booted from snapshots inherit an empty label from the
+		// snapshot image.
+		if container.Labels[HelperLabel] == "" || time.Unix(container.Created, 0).After(cutoff) ||
+			ownerRunning(container.Labels) {
+			continue
+		}
+
+		err := dockerClient.ContainerRemove(ctx, container.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			return result, fmt.Errorf("remove container %s: %w", container.ID, err)
+		}
+		result.Containers = append(result.Containers, container.ID)
+	}
+
+	images, err := dockerClient.ImageList(ctx, types.ImageListOptions{
+		All:     true,
+		Filters: helperFilter,
+	})
+	if err != nil {
+		return result, fmt.Errorf("list images: %w", err)
+	}
+
+	var candidates []types.ImageSummary
+	for _, image := range images {
+		if image.Labels[HelperLabel] != "" && time.Unix(image.Created, 0).Before(cutoff) &&
+			!ownerRunning(image.Labels) {
+			candidates = append(candidates, image)
+		}
+	}
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	referenced, err := referencedImages(ctx, dockerClient)
+	if err != nil {
+		return result, err
+	}
+
+	for _, image := range candidates {
+		if referenced[image.ID] {
+			continue
+		}
+
+		_, err := dockerClient.ImageRemove(ctx, image.ID, types.ImageRemoveOptions{PruneChildren: true})
+		switch {
+		// Images that are still used by containers, or that other images
+		// are built on, can't be removed.
+		case errdefs.IsConflict(err):
+			continue
+		case err != nil:
+			return result, fmt.Errorf("remove image %s: %w", image.ID, err)
+		}
+		result.Images = append(result.Images, image.ID)
+	}
+	return result, nil
+}
+
+// referencedImages returns the IDs of the images that snapshots are built
+// on, including previous versions of relabeled snapshots.
+func referencedImages(ctx context.Context, dockerClient DockerClient) (map[string]bool, error) {
+	images, err := dockerClient.ImageList(ctx, types.ImageListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", CreatedLabel)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list images: %w", err)
+	}
+
+	referenced := map[string]bool{}
+	for _, image := range images {
+		// Commits of containers booted from snapshots inherit the
+		// snapshot's labels, but they aren't snapshots themselves.
+		if image.Labels[HelperLabel] != "" {
+			continue
+		}
+
+		history, err := dockerClient.ImageHistory(ctx, image.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get history of %s: %w", image.ID, err)
+		}
+
+		for _, layer := range history {
+			referenced[layer.ID] = true
+		}
+	}
+	return referenced, nil
+}
+
+// helperLabels returns the labels for a helper container with the given
+// purpose.
+func helperLabels(purpose string) map[string]string {
+	return map[string]string{
+		HelperLabel:      purpose,
+		HelperOwnerLabel: helperOwner(),
+	}
+}
+
+// helperOwner identifies the current process in HelperOwnerLabel.
+func helperOwner() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// ownerRunning returns whether the helper with the given labels was created
+// by a process on this host that's still running. The processes of other
+// hosts can't be checked, so their helpers are only kept until minAge.
+func ownerRunning(labels map[string]string) bool {
+	hostname, _ := os.Hostname()
+	owner := labels[HelperOwnerLabel]
+	sep := strings.LastIndex(owner, ":")
+	if sep == -1 || owner[:sep] != hostname {
+		return false
+	}
+
+	pid, err := strconv.Atoi(owner[sep+1:])
+	if err != nil {
+		return false
+	}
+
+	// Signal 0 only checks whether the process exists.
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,49 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+func TestGCKeepsRunningOwners(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDocker(&postgresDB{})
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("get hostname: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		owner   string
+		removed bool
+	}{
+		{"running", helperOwner(), false},
+		// The PID is larger than the maximum PID on Linux.
+		{"exited", fmt.Sprintf("%s:%d", hostname, 1<<30), true},
+		{"other-host", "other-host:1", true},
+		{"unowned", "", true},
+	}
+	for _, test := range tests {
+		labels := map[string]string{HelperLabel: "dump"}
+		if test.owner != "" {
+			labels[HelperOwnerLabel] = test.owner
+		}
+		runContainer(t, client, test.name, &containerTypes.Config{Image: "app", Labels: labels}, nil)
+	}
+
+	if _, err := GC(ctx, client, 0); err != nil {
+		t.Fatalf("gc: %s", err)
+	}
+
+	for _, test := range tests {
+		_, err := client.ContainerInspect(ctx, test.name)
+		if removed := err != nil; removed != test.removed {
+			t.Errorf("%s: removed %t, expected %t", test.name, removed, test.removed)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+)
+
+// HookStage is when a hook runs relative to the snapshot.
+type HookStage string
+
+const (
+	// HookPre hooks run before the snapshot is created. If one fails, the
+	// snapshot isn't created.
+	HookPre HookStage = "pre"
+
+	// HookPost hooks run after the snapshot is created, or after it failed.
+	// They run whenever the pre hooks succeeded, so that they can undo the
+	// pre hooks. The DKSNAP_STATUS environment variable is set to
+	// "success" or "failure".
+	HookPost HookStage = "post"
+)
+
+// Hook is a shell command that runs before or after a container is
+// snapshotted, such as flushing caches or uploading the snapshot.
+//
+// The command is run with `sh -c`, and has the following environment
+// variables:
+//
+//   - DKSNAP_HOOK: the stage of the hook, either "pre" or "post".
+//   - DKSNAP_CONTAINER: the name of the container being snapshotted.
+//   - DKSNAP_TITLE: the title of the snapshot.
+//   - DKSNAP_IMAGE: the image name of the snapshot.
+//   - DKSNAP_STATUS: whether the snapshot succeeded, for post hooks.
+type Hook struct {
+	Stage   HookStage
+	Command string
+
+	// Host runs the command on the host rather than inside the container.
+	// Container hooks are skipped if the container isn't running, since
+	// commands can't be executed in it.
+	Host bool
+}
+
+// LabelHooks returns the hooks declared with PreHookLabel and PostHookLabel.
+// They always run inside the container, since the labels are controlled by
+// whoever built the image, and shouldn't be able to run commands on the
+// host.
+func LabelHooks(labels map[string]string) []Hook {
+	var hooks []Hook
+	if command := strings.TrimSpace(labels[PreHookLabel]); command != "" {
+		hooks = append(hooks, Hook{Stage: HookPre, Command: command})
+	}
+	if command := strings.TrimSpace(labels[PostHookLabel]); command != "" {
+		hooks = append(hooks, Hook{Stage: HookPost, Command: command})
+	}
+	return hooks
+}
+
+// RunHook runs the hook for the given container. env contains the
+// environment variables described in Hook, in KEY=VALUE form. The output of
+// the command is written to out. The returned error includes the command's
+// stderr if it fails.
+func RunHook(ctx context.Context, dockerClient DockerClient, container types.ContainerJSON, hook Hook,
+	env []string, out io.Writer) error {
+	cmd := []string{"sh", "-c", hook.Command}
+	if !hook.Host {
+		stdout, err := execWithEnv(ctx, dockerClient, container.ID, cmd, env)
+		if err != nil {
+			return fmt.Errorf("run %s hook %q: %w", hook.Stage, hook.Command, err)
+		}
+		_, err = out.Write(stdout)
+		return err
+	}
+
+	var stderr bytes.Buffer
+	hostCmd := osexec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	hostCmd.Env = append(os.Environ(), env...)
+	hostCmd.Stdout = out
+	hostCmd.Stderr = &stderr
+	if err := hostCmd.Run(); err != nil {
+		return fmt.Errorf("run %s hook %q on host: %w: %s", hook.Stage, hook.Command, err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
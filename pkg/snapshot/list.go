@@ -2,15 +2,26 @@ package snapshot
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"sort"
-	"time"
+	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 )
 
-// List returns all the snapshots on the local machine.
-func List(ctx context.Context, dockerClient *client.Client) ([]*Snapshot, error) {
+// skippedImages are the images that List has warned about, so that each
+// warning is only logged once.
+var (
+	skippedImages     = map[string]bool{}
+	skippedImagesLock sync.Mutex
+)
+
+// List returns all the snapshots on the local machine. Snapshots created by
+// newer versions of dksnap are skipped with a warning.
+func List(ctx context.Context, dockerClient DockerClient) ([]*Snapshot, error) {
 	images, err := dockerClient.ImageList(ctx, types.ImageListOptions{
 		All: true,
 	})
@@ -18,15 +29,21 @@ func List(ctx context.Context, dockerClient *client.Client) ([]*Snapshot, error)
 		return nil, err
 	}
 
-	// Parse all the snapshots.
+	// Parse all the snapshots, and track which images have been replaced by
+	// a relabeled version. The superseded images are usually untagged, so
+	// this must look at all images.
 	snapshotsByImageID := map[string]*Snapshot{}
+	supersededBy := map[string]string{}
 	for _, img := range images {
+		if supersedes := img.Labels[SupersedesLabel]; supersedes != "" {
+			supersededBy[supersedes] = img.ID
+		}
+
 		if len(img.RepoTags) == 0 || (len(img.RepoTags) == 1 && img.RepoTags[0] == "<none>:<none>") {
 			continue
 		}
 
-		createdStr, ok := img.Labels[CreatedLabel]
-		if !ok {
+		if _, ok := img.Labels[CreatedLabel]; !ok {
 			snapshotsByImageID[img.ID] = &Snapshot{
 				BaseImage:  true,
 				ImageID:    img.ID,
@@ -35,18 +52,34 @@ func List(ctx context.Context, dockerClient *client.Client) ([]*Snapshot, error)
 			continue
 		}
 
-		var snap Snapshot
-		created, err := time.Parse(time.RFC3339, createdStr)
+		snap, err := parseSnapshot(img)
+		if errors.Is(err, errNewerSchema) {
+			warnSkipped(img.ID, err)
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
-		snap.Created = created
-		snap.Title = img.Labels[TitleLabel]
-		snap.DumpPath = img.Labels[DumpPathLabel]
-		snap.ImageID = img.ID
-		snap.ImageNames = img.RepoTags
+		snapshotsByImageID[snap.ImageID] = snap
+	}
+
+	// latestVersion returns the newest snapshot that replaces the given
+	// image, or nil if there are no snapshots for the image.
+	latestVersion := func(imageID string) *Snapshot {
+		var latest *Snapshot
+		// Bound the number of iterations in case of a cycle.
+		for i := 0; i <= len(supersededBy); i++ {
+			if snap, ok := snapshotsByImageID[imageID]; ok {
+				latest = snap
+			}
 
-		snapshotsByImageID[snap.ImageID] = &snap
+			next, ok := supersededBy[imageID]
+			if !ok {
+				break
+			}
+			imageID = next
+		}
+		return latest
 	}
 
 	// Populate parents.
@@ -56,24 +89,39 @@ func List(ctx context.Context, dockerClient *client.Client) ([]*Snapshot, error)
 			continue
 		}
 
+		// Hide snapshots that have been replaced by a relabeled version.
+		if latestVersion(snapshot.ImageID) != snapshot {
+			continue
+		}
+
 		snapshotHistory, err := dockerClient.ImageHistory(ctx, snapshot.ImageID)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, parentImage := range snapshotHistory {
+		parentIndex := len(snapshotHistory)
+		for i, parentImage := range snapshotHistory {
 			if parentImage.ID == snapshot.ImageID {
 				continue
 			}
 
-			// Find the first snapshot parent.
-			if parentSnapshot, ok := snapshotsByImageID[parentImage.ID]; ok {
+			// Find the first snapshot parent. Relabeled images are built on
+			// top of the image they replace, so skip past any previous
+			// versions of this snapshot.
+			parentSnapshot := latestVersion(parentImage.ID)
+			if parentSnapshot != nil && parentSnapshot != snapshot {
 				snapshot.Parent = parentSnapshot
 				parentSnapshot.Children = append(parentSnapshot.Children, snapshot)
+				parentIndex = i
 				break
 			}
 		}
 
+		snapshot.Size = diskUsage(snapshot, snapshotHistory, parentIndex, func(imageID string) bool {
+			image, ok := snapshotsByImageID[imageID]
+			return ok && image.BaseImage
+		})
+
 		snapshots = append(snapshots, snapshot)
 	}
 
@@ -82,3 +130,48 @@ func List(ctx context.Context, dockerClient *client.Client) ([]*Snapshot, error)
 	})
 	return snapshots, nil
 }
+
+// Find returns the snapshot referenced by ref. The reference can be an image
+// name, an image ID prefix, or a snapshot title.
+func Find(snapshots []*Snapshot, ref string) (*Snapshot, error) {
+	var matches []*Snapshot
+	for _, snap := range snapshots {
+		if snapshotMatches(snap, ref) {
+			matches = append(matches, snap)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no snapshot matches %q", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("ambiguous reference %q matches %d snapshots", ref, len(matches))
+	}
+}
+
+func snapshotMatches(snap *Snapshot, ref string) bool {
+	for _, name := range snap.ImageNames {
+		if name == ref || name == ref+":latest" {
+			return true
+		}
+	}
+
+	if ref != "" && strings.HasPrefix(strings.TrimPrefix(snap.ImageID, "sha256:"), strings.TrimPrefix(ref, "sha256:")) {
+		return true
+	}
+	return snap.Title == ref
+}
+
+// warnSkipped logs that List skipped the image, unless it was already logged.
+func warnSkipped(imageID string, err error) {
+	skippedImagesLock.Lock()
+	defer skippedImagesLock.Unlock()
+
+	if skippedImages[imageID] {
+		return
+	}
+	skippedImages[imageID] = true
+	log.Printf("Skipping snapshot: %s. Upgrade dksnap to use it.", err)
+}
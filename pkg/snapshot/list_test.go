@@ -0,0 +1,153 @@
+package snapshot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+
+	"github.com/kelda/dksnap/pkg/fakedocker"
+)
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	first := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "First")
+
+	// Snapshot a container booted from the first snapshot, so that the
+	// second snapshot is its child.
+	booted := runContainer(t, client, "booted", &containerTypes.Config{Image: first.ImageNames[0]}, nil)
+	db.dump = "CREATE TABLE users;\nINSERT INTO users VALUES ('kevin');\n"
+	createSnapshot(t, client, NewPostgres(client, "postgres"), booted, "Second")
+
+	snapshots, err := List(ctx, client)
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("listed %d snapshots, expected 2", len(snapshots))
+	}
+	first = findListed(t, snapshots, "First")
+	second := findListed(t, snapshots, "Second")
+
+	if !reflect.DeepEqual(first.ImageNames, []string{"first:latest"}) {
+		t.Errorf("unexpected image names %v", first.ImageNames)
+	}
+	if first.Source.ContainerName != "db" || second.Source.ContainerName != "booted" {
+		t.Errorf("unexpected sources %+v and %+v", first.Source, second.Source)
+	}
+
+	// The first snapshot's parent is the image of the snapshotted
+	// container.
+	if first.Parent == nil || !first.Parent.BaseImage ||
+		!reflect.DeepEqual(first.Parent.ImageNames, []string{"postgres:12"}) {
+		t.Errorf("first snapshot's parent should be the postgres image, got %+v", first.Parent)
+	}
+	if second.Parent != first {
+		t.Errorf("second snapshot's parent should be the first snapshot, got %+v", second.Parent)
+	}
+	if len(first.Children) != 1 || first.Children[0] != second {
+		t.Errorf("first snapshot's children should be the second snapshot, got %v", first.Children)
+	}
+
+	// The base image is shared by both snapshots, and the second snapshot
+	// shares the first snapshot's layers.
+	if first.Size.BaseImageID != first.Parent.ImageID || second.Size.BaseImageID != first.Parent.ImageID {
+		t.Errorf("snapshots should be based on %s, got %s and %s",
+			first.Parent.ImageID, first.Size.BaseImageID, second.Size.BaseImageID)
+	}
+	if first.Size.Shared != 0 || second.Size.Shared != first.Size.Unique {
+		t.Errorf("second snapshot should share the first snapshot's %d bytes, got %d",
+			first.Size.Unique, second.Size.Shared)
+	}
+	if first.Size.Dump != int64(len("CREATE TABLE users;\n")) || second.Size.Dump != int64(len(db.dump)) {
+		t.Errorf("unexpected dump sizes %d and %d", first.Size.Dump, second.Size.Dump)
+	}
+}
+
+func TestListRelabeled(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	first := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "First")
+	booted := runContainer(t, client, "booted", &containerTypes.Config{Image: first.ImageNames[0]}, nil)
+	createSnapshot(t, client, NewPostgres(client, "postgres"), booted, "Second")
+
+	err := Edit(ctx, client, first, EditOptions{
+		Title:       "Renamed",
+		Description: "Just the schema.",
+		Tags:        []string{"schema"},
+		Pinned:      true,
+	})
+	if err != nil {
+		t.Fatalf("edit: %s", err)
+	}
+
+	// The original version of the snapshot is hidden, and its children are
+	// attached to the new version.
+	snapshots, err := List(ctx, client)
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("listed %d snapshots, expected 2", len(snapshots))
+	}
+	renamed := findListed(t, snapshots, "Renamed")
+	second := findListed(t, snapshots, "Second")
+
+	if renamed.ImageID == first.ImageID {
+		t.Errorf("the snapshot wasn't rebuilt")
+	}
+	if !reflect.DeepEqual(renamed.ImageNames, first.ImageNames) {
+		t.Errorf("image names %v weren't moved to the new version, got %v", first.ImageNames, renamed.ImageNames)
+	}
+	if renamed.Description != "Just the schema." || !reflect.DeepEqual(renamed.Tags, []string{"schema"}) ||
+		!renamed.Pinned {
+		t.Errorf("metadata wasn't updated: %+v", renamed)
+	}
+	if renamed.DumpChecksum != first.DumpChecksum || renamed.Snapshotter != "postgres" {
+		t.Errorf("other metadata wasn't kept: %+v", renamed)
+	}
+	if second.Parent != renamed {
+		t.Errorf("second snapshot's parent should be the renamed snapshot, got %+v", second.Parent)
+	}
+}
+
+func findListed(t *testing.T, snapshots []*Snapshot, title string) *Snapshot {
+	snap, err := Find(snapshots, title)
+	if err != nil {
+		t.Fatalf("find %s: %s", title, err)
+	}
+	return snap
+}
+
+func TestListNewerSchema(t *testing.T) {
+	client := newFakeDocker(&postgresDB{})
+	container := runContainer(t, client, "app", &containerTypes.Config{Image: "app"}, nil)
+	snap := createSnapshot(t, client, NewGeneric(client), container, "Current Snapshot")
+
+	// Snapshots created by a newer version of dksnap are skipped rather than
+	// breaking the list.
+	client.AddImage("future", fakedocker.Image{
+		Labels: map[string]string{
+			SchemaVersionLabel: "3",
+			CreatedLabel:       "2020-01-01T00:00:00Z",
+			TitleLabel:         "Future Snapshot",
+		},
+	})
+
+	snapshots, err := List(context.Background(), client)
+	if err != nil {
+		t.Fatalf("list: %s", err)
+	}
+	if _, err := Find(snapshots, snap.ImageID); err != nil {
+		t.Errorf("current snapshot is missing: %s", err)
+	}
+	if _, err := Find(snapshots, "future"); err == nil {
+		t.Errorf("snapshot with a newer schema was listed")
+	}
+}
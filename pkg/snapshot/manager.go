@@ -0,0 +1,221 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// Manager provides the operations of the dksnap command line and terminal UI
+// as a library. For example, integration tests can restore a database to a
+// known state in TestMain:
+//
+//	manager, err := snapshot.NewManagerFromEnv()
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	ctx := context.Background()
+//	seed, err := manager.Find(ctx, "seed-v3")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+//	if err := manager.Replace(ctx, "db", seed, ioutil.Discard); err != nil {
+//		log.Fatal(err)
+//	}
+type Manager struct {
+	client DockerClient
+}
+
+// NewManager creates a Manager that uses the given Docker client. Tests that
+// shouldn't depend on a Docker daemon can pass a fakedocker.Client.
+func NewManager(dockerClient DockerClient) *Manager {
+	return &Manager{client: dockerClient}
+}
+
+// NewManagerFromEnv creates a Manager that connects to Docker using the
+// standard environment variables, such as DOCKER_HOST.
+func NewManagerFromEnv() (*Manager, error) {
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("create Docker client: %w", err)
+	}
+	return NewManager(dockerClient), nil
+}
+
+// ManagerCreateOptions configures how Manager.Create snapshots a container.
+type ManagerCreateOptions struct {
+	CreateOptions
+	SelectOptions
+
+	// OnFallback is called with the error from the database aware
+	// snapshotter if it fails, before falling back to a generic snapshot.
+	OnFallback func(error)
+}
+
+// Create snapshots the container with the given name or ID, and returns the
+// new snapshot. It uses the database aware snapshotter for the databases
+// running in the container, and falls back to a generic snapshot if that
+// fails. The image name defaults to a name derived from the title.
+func (m *Manager) Create(ctx context.Context, container string, opts ManagerCreateOptions) (*Snapshot, error) {
+	if opts.Title == "" {
+		return nil, errors.New("a title is required")
+	}
+	if opts.ImageName == "" {
+		opts.ImageName = ImageNameForTitle(opts.Title)
+	}
+
+	info, err := m.inspectContainer(ctx, container)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotter := NewSnapshotter(m.client, info, DetectDatabases(ctx, m.client, info), opts.SelectOptions)
+	err = CreateWithFallback(ctx, m.client, snapshotter, info, opts.CreateOptions, opts.OnFallback)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the new snapshot by its exact image name rather than with
+	// Find, which also matches titles and image ID prefixes, and so could
+	// match other snapshots.
+	image, _, err := m.client.ImageInspectWithRaw(ctx, opts.ImageName)
+	if err != nil {
+		return nil, fmt.Errorf("inspect snapshot image: %w", err)
+	}
+	snapshots, err := List(ctx, m.client)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	for _, snap := range snapshots {
+		if snap.ImageID == image.ID {
+			return snap, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot image %s not found", image.ID)
+}
+
+// inspectContainer inspects the container, and references its image by the
+// name shown by `docker ps`, so that it can be used as the base image of
+// snapshots.
+func (m *Manager) inspectContainer(ctx context.Context, container string) (types.ContainerJSON, error) {
+	info, err := m.client.ContainerInspect(ctx, container)
+	if err != nil {
+		return info, fmt.Errorf("inspect container: %w", err)
+	}
+
+	containers, err := m.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("id", info.ID)),
+	})
+	if err != nil {
+		return info, fmt.Errorf("list containers: %w", err)
+	}
+	if len(containers) == 1 {
+		info.Image = containers[0].Image
+	}
+	return info, nil
+}
+
+// List returns all the snapshots on the local machine. See List.
+func (m *Manager) List(ctx context.Context) ([]*Snapshot, error) {
+	return List(ctx, m.client)
+}
+
+// Find returns the snapshot referenced by ref. See Find for the supported
+// references.
+func (m *Manager) Find(ctx context.Context, ref string) (*Snapshot, error) {
+	snapshots, err := List(ctx, m.client)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	return Find(snapshots, ref)
+}
+
+// Boot creates and starts a new container from the snapshot, and waits for
+// it to become ready. See Boot.
+func (m *Manager) Boot(ctx context.Context, snap *Snapshot, opts BootOptions, logs io.Writer) (BootResult, error) {
+	return Boot(ctx, m.client, snap, opts, logs)
+}
+
+// Replace replaces the container with the given name or ID with a container
+// running the snapshot, and waits for it to become ready. See Replace.
+//
+// Unlike the dksnap TUI, Replace doesn't write a docker-compose override
+// file that pins the service to the snapshot. If the container belongs to a
+// docker-compose project, `docker-compose up` recreates it from the
+// service's configured image, discarding the snapshot.
+//
+// Volumes aren't rolled back if the replacement fails. See Replace.
+func (m *Manager) Replace(ctx context.Context, container string, snap *Snapshot, logs io.Writer) error {
+	info, err := m.inspectContainer(ctx, container)
+	if err != nil {
+		return err
+	}
+	return Replace(ctx, m.client, info, snap, logs)
+}
+
+// ReplaceGroup replaces the containers that the snapshots in a group were
+// created from. containers maps each snapshot to the name or ID of the
+// container that it replaces. Like Replace, docker-compose services aren't
+// pinned to the snapshots. See ReplaceGroup.
+func (m *Manager) ReplaceGroup(ctx context.Context, group []*Snapshot, containers map[*Snapshot]string,
+	logs io.Writer) error {
+	infos := map[*Snapshot]types.ContainerJSON{}
+	for _, snap := range group {
+		info, err := m.inspectContainer(ctx, containers[snap])
+		if err != nil {
+			return err
+		}
+		infos[snap] = info
+	}
+	return ReplaceGroup(ctx, m.client, group, infos, logs)
+}
+
+// Reset restarts the container with the given name or ID, which must have
+// been booted from a snapshot, with the snapshot's data. See Reset.
+func (m *Manager) Reset(ctx context.Context, container string, logs io.Writer) error {
+	return Reset(ctx, m.client, container, logs)
+}
+
+// RestoreVolume replaces the contents of the named volume with the contents
+// of a volume snapshot. See RestoreVolume.
+func (m *Manager) RestoreVolume(ctx context.Context, snap *Snapshot, volumeName string) error {
+	return RestoreVolume(ctx, m.client, snap, volumeName)
+}
+
+// Edit changes the metadata of the snapshot. See Edit.
+func (m *Manager) Edit(ctx context.Context, snap *Snapshot, opts EditOptions) error {
+	return Edit(ctx, m.client, snap, opts)
+}
+
+// Delete removes the snapshot. Pinned snapshots are only removed if force is
+// set. See Remove.
+func (m *Manager) Delete(ctx context.Context, snap *Snapshot, force bool) error {
+	return Remove(ctx, m.client, snap, force)
+}
+
+// Diff returns the diff between the database dumps of the snapshots. See
+// Diff.
+func (m *Manager) Diff(ctx context.Context, x, y *Snapshot) (string, error) {
+	return Diff(ctx, m.client, x, y)
+}
+
+// ImageNameForTitle converts a snapshot title into a valid image name.
+func ImageNameForTitle(title string) string {
+	image := strings.ToLower(title)
+
+	// Convert spaces into a legal separator.
+	image = strings.Replace(image, " ", "-", -1)
+
+	// Remove all other illegal characters.
+	return regexp.MustCompile(`[^\w.-]`).ReplaceAllString(image, "")
+}
@@ -0,0 +1,37 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+func TestManagerCreate(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDocker(&postgresDB{})
+	runContainer(t, client, "app", &containerTypes.Config{Image: "app"}, nil)
+	manager := NewManager(client)
+
+	// The title of the first snapshot is the image name of the second, so
+	// Find would consider the second snapshot's image name ambiguous.
+	first, err := manager.Create(ctx, "app", ManagerCreateOptions{
+		CreateOptions: CreateOptions{Title: "db", ImageName: "first"},
+	})
+	if err != nil {
+		t.Fatalf("create first snapshot: %s", err)
+	}
+
+	for _, imageName := range []string{"db", "docker.io/library/second"} {
+		snap, err := manager.Create(ctx, "app", ManagerCreateOptions{
+			CreateOptions: CreateOptions{Title: "Snapshot " + imageName, ImageName: imageName},
+		})
+		if err != nil {
+			t.Errorf("create %s: %s", imageName, err)
+			continue
+		}
+		if snap.ImageID == first.ImageID || snap.Title != "Snapshot "+imageName {
+			t.Errorf("create %s returned the wrong snapshot: %+v", imageName, snap)
+		}
+	}
+}
@@ -8,29 +8,52 @@ import (
 	"path/filepath"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 )
 
 // Mongo creates snapshots for Mongo containers. It dumps the database
 // using `mongodump`.
 type Mongo struct {
-	client *client.Client
+	client DockerClient
 }
 
 // NewMongo creates a new mongo snapshotter.
-func NewMongo(c *client.Client) Snapshotter {
+func NewMongo(c DockerClient) Snapshotter {
 	return &Mongo{c}
 }
 
 // Create creates a new snapshot.
-func (c *Mongo) Create(ctx context.Context, container types.ContainerJSON, title, imageName string) error {
+func (c *Mongo) Create(ctx context.Context, container types.ContainerJSON, opts CreateOptions) error {
 	buildContext, err := ioutil.TempDir("", "dksnap-context")
 	if err != nil {
 		return fmt.Errorf("make build context dir: %w", err)
 	}
 	defer os.RemoveAll(buildContext)
 
-	dump, err := exec(ctx, c.client, container.ID, []string{"mongodump", "--archive"})
+	// Images for Mongo 6.0 and later only ship the mongosh shell, while
+	// older images only have the legacy mongo shell.
+	pingArgs := `--host 127.0.0.1 --quiet --eval "db.adminCommand('ping')"`
+	ping := fmt.Sprintf("if command -v mongosh >/dev/null; then exec mongosh %[1]s; else exec mongo %[1]s; fi",
+		pingArgs)
+
+	// Unlike Postgres and MySQL, the temporary mongod that the official
+	// entrypoint runs while loading the dump listens on 127.0.0.1, so a ping
+	// succeeds before the dump is fully loaded. Containers booted from the
+	// snapshot are only ready once the marker written after the dump loads
+	// exists, and the entrypoint has shut down the temporary mongod, which
+	// removes its PID file.
+	marker := "/data/db/" + restoreMarker
+	readinessProbe := []string{"sh", "-c", fmt.Sprintf(
+		"[ -e %q ] && [ ! -e /tmp/docker-entrypoint-temp-mongod.pid ] && %s", marker, ping)}
+
+	// The dump container boots from data that's already loaded, so it only
+	// needs to respond to pings.
+	dumpContainer, cleanup, err := startDumpContainer(ctx, c.client, container, []string{"sh", "-c", ping})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	dump, err := exec(ctx, c.client, dumpContainer, []string{"mongodump", "--archive"})
 	if err != nil {
 		return fmt.Errorf("dump: %w", err)
 	}
@@ -47,16 +70,24 @@ func (c *Mongo) Create(ctx context.Context, container types.ContainerJSON, title
 	err = buildImage(ctx, c.client, buildOptions{
 		baseImage: container.Image,
 		context:   buildContext,
-		bootCommands: []string{
-			"rm -rf /data/db/*",
-		},
+		bootCommands: []bootCommand{{
+			description:   "Clear the database so that the dump is loaded.",
+			script:        "rm -rf /data/db/*",
+			marker:        marker,
+			markAfterInit: true,
+		}},
 		buildInstructions: []string{
 			"COPY dump.archive /dksnap/dump.archive",
 			"COPY load-dump.sh /docker-entrypoint-initdb.d/load-dump.sh",
 		},
-		title:      title,
-		imageNames: []string{imageName},
-		dumpPath:   "/dksnap/dump.archive",
+		createOptions: opts,
+		container:     container,
+		snapshotter:   "mongo",
+		engineVersion: getEngineVersion(ctx, c.client, dumpContainer, []string{"mongod", "--version"}),
+		dumpChecksum:  checksum(dump),
+
+		readinessProbe: readinessProbe,
+		dumpPath:       "/dksnap/dump.archive",
 	})
 	if err != nil {
 		return fmt.Errorf("build image: %w", err)
@@ -8,29 +8,38 @@ import (
 	"path/filepath"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 )
 
 // MySQL creates snapshots for MySQL containers. It dumps the database
 // using `mysqldump`.
 type MySQL struct {
-	client *client.Client
+	client DockerClient
 }
 
 // NewMySQL creates a new mongo snapshotter.
-func NewMySQL(c *client.Client) Snapshotter {
+func NewMySQL(c DockerClient) Snapshotter {
 	return &MySQL{c}
 }
 
 // Create creates a new snapshot.
-func (c *MySQL) Create(ctx context.Context, container types.ContainerJSON, title, imageName string) error {
+func (c *MySQL) Create(ctx context.Context, container types.ContainerJSON, opts CreateOptions) error {
 	buildContext, err := ioutil.TempDir("", "dksnap-context")
 	if err != nil {
 		return fmt.Errorf("make build context dir: %w", err)
 	}
 	defer os.RemoveAll(buildContext)
 
-	dump, err := exec(ctx, c.client, container.ID, []string{"mysqldump", "--all-databases"})
+	// Connect over TCP because the database only listens on a Unix socket
+	// while it's loading the dump.
+	readinessProbe := []string{"mysqladmin", "ping", "-h", "127.0.0.1"}
+
+	dumpContainer, cleanup, err := startDumpContainer(ctx, c.client, container, readinessProbe)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	dump, err := exec(ctx, c.client, dumpContainer, []string{"mysqldump", "--all-databases"})
 	if err != nil {
 		return fmt.Errorf("dump: %w", err)
 	}
@@ -42,15 +51,23 @@ func (c *MySQL) Create(ctx context.Context, container types.ContainerJSON, title
 	err = buildImage(ctx, c.client, buildOptions{
 		baseImage: container.Image,
 		context:   buildContext,
-		bootCommands: []string{
-			"rm -rf /var/lib/mysql/*",
-		},
+		bootCommands: []bootCommand{{
+			description:   "Clear the database so that the dump is loaded.",
+			script:        "rm -rf /var/lib/mysql/*",
+			marker:        "/var/lib/mysql/" + restoreMarker,
+			markAfterInit: true,
+		}},
 		buildInstructions: []string{
 			"COPY dump.sql /docker-entrypoint-initdb.d/dump.sql",
 		},
-		title:      title,
-		imageNames: []string{imageName},
-		dumpPath:   "/docker-entrypoint-initdb.d/dump.sql",
+		createOptions: opts,
+		container:     container,
+		snapshotter:   "mysql",
+		engineVersion: getEngineVersion(ctx, c.client, dumpContainer, []string{"mysqld", "--version"}),
+		dumpChecksum:  checksum(dump),
+
+		readinessProbe: readinessProbe,
+		dumpPath:       "/docker-entrypoint-initdb.d/dump.sql",
 	})
 	if err != nil {
 		return fmt.Errorf("build image: %w", err)
@@ -7,33 +7,43 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 )
 
 // Postgres creates snapshots for Postgres containers. It dumps the
 // database using pg_dumpall.
 type Postgres struct {
-	client *client.Client
+	client DockerClient
 	dbUser string
 }
 
 // NewPostgres creates a new Postgres snapshotter.
-func NewPostgres(c *client.Client, dbUser string) Snapshotter {
+func NewPostgres(c DockerClient, dbUser string) Snapshotter {
 	return &Postgres{c, dbUser}
 }
 
 // Create creates a new snapshot.
-func (c *Postgres) Create(ctx context.Context, container types.ContainerJSON, title, imageName string) error {
+func (c *Postgres) Create(ctx context.Context, container types.ContainerJSON, opts CreateOptions) error {
 	buildContext, err := ioutil.TempDir("", "dksnap-context")
 	if err != nil {
 		return fmt.Errorf("make build context dir: %w", err)
 	}
 	defer os.RemoveAll(buildContext)
 
-	dump, err := exec(ctx, c.client, container.ID, []string{"pg_dumpall", "-U", c.dbUser})
+	// Connect over TCP because the database only listens on a Unix socket
+	// while it's loading the dump.
+	readinessProbe := []string{"pg_isready", "-h", "127.0.0.1"}
+
+	dumpContainer, cleanup, err := startDumpContainer(ctx, c.client, container, readinessProbe)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	dump, err := exec(ctx, c.client, dumpContainer, []string{"pg_dumpall", "-U", c.dbUser})
 	if err != nil {
 		return fmt.Errorf("dump: %w", err)
 	}
@@ -54,16 +64,24 @@ psql --username "${POSTGRES_USER:-postgres}" -d "${POSTGRES_DB:-postgres}" --no-
 	err = buildImage(ctx, c.client, buildOptions{
 		baseImage: container.Image,
 		context:   buildContext,
-		bootCommands: []string{
-			"rm -rf /var/lib/postgresql/data/*",
-		},
+		bootCommands: []bootCommand{{
+			description:   "Clear the database so that the dump is loaded.",
+			script:        "rm -rf /var/lib/postgresql/data/*",
+			marker:        "/var/lib/postgresql/data/" + restoreMarker,
+			markAfterInit: true,
+		}},
 		buildInstructions: []string{
 			"COPY load-dump.sh /docker-entrypoint-initdb.d/load-dump.sh",
 			"COPY dump.sql /dksnap-dump.sql",
 		},
-		title:      title,
-		imageNames: []string{imageName},
-		dumpPath:   "/dksnap-dump.sql",
+		createOptions: opts,
+		container:     container,
+		snapshotter:   "postgres",
+		engineVersion: getEngineVersion(ctx, c.client, dumpContainer, []string{"postgres", "--version"}),
+		dumpChecksum:  checksum(dump),
+
+		readinessProbe: readinessProbe,
+		dumpPath:       "/dksnap-dump.sql",
 	})
 	if err != nil {
 		return fmt.Errorf("build image: %w", err)
@@ -71,9 +89,26 @@ psql --username "${POSTGRES_USER:-postgres}" -d "${POSTGRES_DB:-postgres}" --no-
 	return nil
 }
 
-func exec(ctx context.Context, dockerClient *client.Client, container string, cmd []string) ([]byte, error) {
+// getEngineVersion returns the first line of the output of the given version
+// command. The version is purely informational, so errors are ignored.
+func getEngineVersion(ctx context.Context, dockerClient DockerClient, container string, cmd []string) string {
+	out, err := exec(ctx, dockerClient, container, cmd)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+}
+
+func exec(ctx context.Context, dockerClient DockerClient, container string, cmd []string) ([]byte, error) {
+	return execWithEnv(ctx, dockerClient, container, cmd, nil)
+}
+
+// execWithEnv is like exec, but sets additional environment variables for
+// the command.
+func execWithEnv(ctx context.Context, dockerClient DockerClient, container string, cmd, env []string) ([]byte, error) {
 	execID, err := dockerClient.ContainerExecCreate(ctx, container, types.ExecConfig{
 		Cmd:          cmd,
+		Env:          env,
 		AttachStderr: true,
 		AttachStdout: true,
 	})
@@ -0,0 +1,145 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// RetentionPolicy decides which snapshots are kept by PlanPrune. A snapshot is
+// pruned if it breaks any of the rules, unless it's pinned, or it's the
+// ancestor of a snapshot that's kept.
+type RetentionPolicy struct {
+	// KeepLast is the number of snapshots to keep for each source container
+	// or volume. Older snapshots from the same source are pruned. Zero
+	// means that there's no limit.
+	KeepLast int
+
+	// MaxAge is the age after which snapshots are pruned. Zero means that
+	// there's no limit.
+	MaxAge time.Duration
+
+	// PrunePinned applies the rules to pinned snapshots as well.
+	PrunePinned bool
+}
+
+// PruneDecision describes whether Prune removes a snapshot, and why.
+type PruneDecision struct {
+	Snapshot *Snapshot
+	Remove   bool
+	Reason   string
+}
+
+// PlanPrune decides which of the snapshots should be pruned according to the
+// policy. The snapshots must come from List so that the parent and child
+// relationships are populated. Snapshots are never pruned while a snapshot
+// that's kept is built on top of them.
+func PlanPrune(snapshots []*Snapshot, policy RetentionPolicy, now time.Time) []PruneDecision {
+	sorted := make([]*Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	decisions := map[*Snapshot]*PruneDecision{}
+	countBySource := map[string]int{}
+	for _, snap := range sorted {
+		decision := &PruneDecision{Snapshot: snap}
+		decisions[snap] = decision
+
+		if snap.Pinned && !policy.PrunePinned {
+			decision.Reason = "pinned"
+			continue
+		}
+
+		// Pinned snapshots only count towards the limit if they can be
+		// pruned too.
+		source := sourceKey(snap)
+		if source != "" {
+			countBySource[source]++
+		}
+
+		switch {
+		case policy.MaxAge > 0 && now.Sub(snap.Created) > policy.MaxAge:
+			decision.Remove = true
+			decision.Reason = fmt.Sprintf("older than %s", policy.MaxAge)
+		case policy.KeepLast > 0 && source != "" && countBySource[source] > policy.KeepLast:
+			decision.Remove = true
+			decision.Reason = fmt.Sprintf("more than %d snapshots of %s", policy.KeepLast, source)
+		}
+	}
+
+	// Keep the ancestors of the snapshots that are kept.
+	for _, snap := range sorted {
+		if decisions[snap].Remove {
+			continue
+		}
+
+		// Bound the number of iterations in case of a cycle.
+		parent := snap.Parent
+		for i := 0; parent != nil && i < len(sorted); i++ {
+			if decision, ok := decisions[parent]; ok && decision.Remove {
+				decision.Remove = false
+				decision.Reason = fmt.Sprintf("parent of %q", snap.Title)
+			}
+			parent = parent.Parent
+		}
+	}
+
+	var result []PruneDecision
+	for _, snap := range sorted {
+		result = append(result, *decisions[snap])
+	}
+	return result
+}
+
+// sourceKey identifies the container or volume that the snapshot was created
+// from. It's empty if the source is unknown, such as for snapshots created by
+// older versions of dksnap.
+func sourceKey(snap *Snapshot) string {
+	switch {
+	case snap.Source.Volume != "":
+		return "volume " + snap.Source.Volume
+	case snap.Source.ContainerName != "":
+		return snap.Source.ContainerName
+	default:
+		return snap.Source.ContainerID
+	}
+}
+
+// ErrPinned is returned when removing a pinned snapshot without forcing it.
+var ErrPinned = errors.New("snapshot is pinned")
+
+// Remove deletes the snapshot's image names. Docker keeps the underlying
+// image around as long as other images are built on top of it, so snapshots
+// created from this snapshot keep working.
+//
+// Pinned snapshots, and snapshots used by containers, are only removed if
+// force is set.
+func Remove(ctx context.Context, dockerClient DockerClient, snap *Snapshot, force bool) error {
+	if snap.BaseImage {
+		return errors.New("can't remove a base image")
+	}
+
+	if snap.Pinned && !force {
+		return fmt.Errorf("remove %q: %w", snap.Title, ErrPinned)
+	}
+
+	for _, name := range snap.ImageNames {
+		_, err := dockerClient.ImageRemove(ctx, name, types.ImageRemoveOptions{
+			Force: force,
+
+			// Also remove the versions of the snapshot that were replaced
+			// when it was relabeled.
+			PruneChildren: true,
+		})
+		if err != nil {
+			return fmt.Errorf("remove image %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package snapshot
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestPlanPrune(t *testing.T) {
+	now := time.Now()
+
+	// makeSnapshots creates snapshots of the given sources, where each
+	// snapshot is an hour older than the previous one.
+	type snapshotSpec struct {
+		title, source, parent string
+		pinned                bool
+	}
+	makeSnapshots := func(specs ...snapshotSpec) []*Snapshot {
+		byTitle := map[string]*Snapshot{}
+		var snapshots []*Snapshot
+		for i, spec := range specs {
+			snap := &Snapshot{
+				Title:   spec.title,
+				Created: now.Add(-time.Duration(i) * time.Hour),
+				Pinned:  spec.pinned,
+				Source:  Source{ContainerName: spec.source},
+			}
+			byTitle[spec.title] = snap
+			snapshots = append(snapshots, snap)
+		}
+		for _, spec := range specs {
+			if parent, ok := byTitle[spec.parent]; ok {
+				byTitle[spec.title].Parent = parent
+				parent.Children = append(parent.Children, byTitle[spec.title])
+			}
+		}
+		return snapshots
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []*Snapshot
+		policy    RetentionPolicy
+		removed   []string
+	}{
+		{
+			name: "keep last per source",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "db-3", source: "db"},
+				snapshotSpec{title: "cache-2", source: "cache"},
+				snapshotSpec{title: "db-2", source: "db"},
+				snapshotSpec{title: "cache-1", source: "cache"},
+				snapshotSpec{title: "db-1", source: "db"},
+			),
+			policy:  RetentionPolicy{KeepLast: 2},
+			removed: []string{"db-1"},
+		},
+		{
+			name: "unknown source",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "new"},
+				snapshotSpec{title: "old"},
+			),
+			policy: RetentionPolicy{KeepLast: 1},
+		},
+		{
+			name: "pinned exempt",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "db-3", source: "db"},
+				snapshotSpec{title: "db-2", source: "db", pinned: true},
+				snapshotSpec{title: "db-1", source: "db"},
+			),
+			policy:  RetentionPolicy{KeepLast: 1},
+			removed: []string{"db-1"},
+		},
+		{
+			name: "prune pinned",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "db-3", source: "db"},
+				snapshotSpec{title: "db-2", source: "db", pinned: true},
+				snapshotSpec{title: "db-1", source: "db"},
+			),
+			policy:  RetentionPolicy{KeepLast: 1, PrunePinned: true},
+			removed: []string{"db-1", "db-2"},
+		},
+		{
+			name: "max age",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "db-3", source: "db"},
+				snapshotSpec{title: "db-2", source: "db"},
+				snapshotSpec{title: "db-1", source: "db"},
+			),
+			policy:  RetentionPolicy{MaxAge: 90 * time.Minute},
+			removed: []string{"db-1"},
+		},
+		{
+			name: "ancestors of kept snapshots",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "child", source: "restored", parent: "parent"},
+				snapshotSpec{title: "db-2", source: "db"},
+				snapshotSpec{title: "parent", source: "db", parent: "grandparent"},
+				snapshotSpec{title: "grandparent", source: "db"},
+			),
+			policy: RetentionPolicy{KeepLast: 1},
+		},
+		{
+			name: "ancestors of pinned snapshots",
+			snapshots: makeSnapshots(
+				snapshotSpec{title: "db-2", source: "db"},
+				snapshotSpec{title: "child", source: "db", parent: "parent", pinned: true},
+				snapshotSpec{title: "parent", source: "db"},
+				snapshotSpec{title: "db-1", source: "db"},
+			),
+			policy:  RetentionPolicy{KeepLast: 1},
+			removed: []string{"db-1"},
+		},
+	}
+	for _, test := range tests {
+		decisions := PlanPrune(test.snapshots, test.policy, now)
+		if len(decisions) != len(test.snapshots) {
+			t.Errorf("%s: got %d decisions for %d snapshots", test.name, len(decisions), len(test.snapshots))
+		}
+
+		var removed []string
+		for _, decision := range decisions {
+			if decision.Remove {
+				removed = append(removed, decision.Snapshot.Title)
+			}
+		}
+		sort.Strings(removed)
+		if !reflect.DeepEqual(removed, test.removed) {
+			t.Errorf("%s: removed %v, expected %v", test.name, removed, test.removed)
+		}
+	}
+}
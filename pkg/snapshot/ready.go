@@ -0,0 +1,177 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+const (
+	// readyGracePeriod is how long containers without a healthcheck or
+	// readiness probe must stay running before they're considered ready.
+	readyGracePeriod = 5 * time.Second
+
+	// failureLogLines is the number of log lines included in the error when
+	// a container fails to become ready.
+	failureLogLines = 10
+)
+
+// WaitReady blocks until the given container is ready to use. If the
+// container has a Docker healthcheck, it waits for the container to become
+// healthy. Otherwise, if a readiness probe is given, the probe is run in the
+// container until it succeeds. Containers with neither are considered ready
+// once they stay running for a short grace period.
+//
+// The container's logs are streamed to logs until the container is ready.
+// If the container fails to become ready, the returned error contains the
+// last lines of the logs.
+func WaitReady(ctx context.Context, dockerClient DockerClient, containerID string, probe []string,
+	logs io.Writer) error {
+	containerInfo, err := dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+
+	logsCtx, cancelLogs := context.WithCancel(ctx)
+	defer cancelLogs()
+
+	tail := &logTail{maxLines: failureLogLines}
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		// Only show the logs from the current run in case the container was
+		// restarted.
+		var since string
+		if containerInfo.State != nil {
+			since = containerInfo.State.StartedAt
+		}
+		streamLogs(logsCtx, dockerClient, containerID, since, containerInfo.Config.Tty, io.MultiWriter(logs, tail))
+	}()
+
+	err = pollReady(ctx, dockerClient, containerID, probe)
+	if err == nil {
+		// Stop streaming logs so that nothing is written to logs once this
+		// returns.
+		cancelLogs()
+		<-logsDone
+		return nil
+	}
+
+	// Give the log stream a moment to catch up so that the error includes
+	// the logs explaining the failure.
+	select {
+	case <-logsDone:
+	case <-time.After(time.Second):
+	}
+	if lastLines := tail.String(); lastLines != "" {
+		return fmt.Errorf("%w\nLast log lines:\n%s", err, lastLines)
+	}
+	return err
+}
+
+func pollReady(ctx context.Context, dockerClient DockerClient, containerID string, probe []string) error {
+	runningSince := time.Now()
+	for {
+		containerInfo, err := dockerClient.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return fmt.Errorf("inspect: %w", err)
+		}
+
+		state := containerInfo.State
+		switch {
+		case !state.Running:
+			return fmt.Errorf("container exited with status %d", state.ExitCode)
+		case state.Health != nil:
+			switch state.Health.Status {
+			case types.Healthy:
+				return nil
+			case types.Unhealthy:
+				return fmt.Errorf("container is unhealthy")
+			}
+		case len(probe) != 0:
+			if _, err := exec(ctx, dockerClient, containerID, probe); err == nil {
+				return nil
+			}
+		case time.Since(runningSince) > readyGracePeriod:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for container to become ready: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// streamLogs copies the container's logs to out until the context is
+// cancelled or the container exits.
+func streamLogs(ctx context.Context, dockerClient DockerClient, containerID, since string, tty bool,
+	out io.Writer) {
+	logStream, err := dockerClient.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      since,
+	})
+	if err != nil {
+		fmt.Fprintf(out, "Failed to get logs: %s\n", err)
+		return
+	}
+	defer logStream.Close()
+
+	// Logs from containers with a TTY aren't multiplexed.
+	if tty {
+		io.Copy(out, logStream)
+	} else {
+		stdcopy.StdCopy(out, out, logStream)
+	}
+}
+
+// logTail is an io.Writer that keeps the last lines written to it.
+type logTail struct {
+	maxLines int
+
+	lock    sync.Mutex
+	lines   []string
+	partial bytes.Buffer
+}
+
+func (t *logTail) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.partial.Write(p)
+	for {
+		line, err := t.partial.ReadString('\n')
+		if err != nil {
+			// Put back the incomplete line until the rest of it is written.
+			t.partial.WriteString(line)
+			break
+		}
+
+		t.lines = append(t.lines, strings.TrimRight(line, "\r\n"))
+		if len(t.lines) > t.maxLines {
+			t.lines = t.lines[len(t.lines)-t.maxLines:]
+		}
+	}
+	return len(p), nil
+}
+
+func (t *logTail) String() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	lines := append([]string{}, t.lines...)
+	if t.partial.Len() != 0 {
+		lines = append(lines, t.partial.String())
+	}
+	return strings.Join(lines, "\n")
+}
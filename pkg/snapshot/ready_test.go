@@ -0,0 +1,52 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	containerTypes "github.com/docker/docker/api/types/container"
+)
+
+// syncBuffer is a bytes.Buffer that's safe for concurrent use.
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestWaitReadyStopsLogs(t *testing.T) {
+	client := newFakeDocker(&postgresDB{})
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12", Tty: true}, nil)
+	if err := client.WriteLogs(container.ID, "database system is ready\n"); err != nil {
+		t.Fatalf("write logs: %s", err)
+	}
+
+	// The logs are streamed until WaitReady returns, but not afterwards.
+	var logs syncBuffer
+	if err := WaitReady(context.Background(), client, container.ID, []string{"pg_isready"}, &logs); err != nil {
+		t.Fatalf("wait ready: %s", err)
+	}
+	returned := logs.String()
+	if returned != "database system is ready\n" {
+		t.Errorf("unexpected logs %q", returned)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if logs.String() != returned {
+		t.Errorf("logs were written after WaitReady returned: %q", logs.String())
+	}
+}
@@ -0,0 +1,266 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	mountTypes "github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+)
+
+// cleanupTimeout is how long rollbacks and other cleanup are given to finish.
+// Cleanup runs on its own context so that it still happens if the caller's
+// context was cancelled or hit its deadline.
+const cleanupTimeout = time.Minute
+
+// CleanupContext returns a context for cleaning up after an operation, such
+// as resuming containers that the operation stopped.
+func CleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), cleanupTimeout)
+}
+
+// replacement tracks a container that's in the process of being replaced by
+// a snapshot. The old container is kept until the replacement is committed
+// so that it can be restored if anything goes wrong.
+type replacement struct {
+	client     DockerClient
+	old        types.ContainerJSON
+	name       string
+	wasRunning bool
+	newID      string
+
+	// started is set once the new container has been started, after which
+	// it may have overwritten the volumes it shares with the old container.
+	started bool
+}
+
+// Replace replaces the old container with a container running the snapshot.
+// The new container has the same name and configuration as the old
+// container. The old container is only removed once the new container has
+// successfully started. If anything fails, the old container is restored.
+//
+// Named volumes and bind mounts are shared by the old and new containers, and
+// aren't rolled back. If the new container started before the replacement
+// failed, they may be left with the snapshot's data, or partially restored
+// data, when the old container is restored.
+func Replace(ctx context.Context, dockerClient DockerClient, old types.ContainerJSON, snap *Snapshot,
+	logs io.Writer) error {
+	r, err := startReplacement(ctx, dockerClient, old, snap, logs)
+	if err != nil {
+		return err
+	}
+	return r.commit(ctx)
+}
+
+// ReplaceGroup replaces the containers that the snapshots in the group were
+// created from. containers maps each snapshot to the container it replaces.
+// If any container fails to be replaced, all the containers are restored. Like
+// Replace, the containers' shared volumes aren't rolled back.
+func ReplaceGroup(ctx context.Context, dockerClient DockerClient, group []*Snapshot,
+	containers map[*Snapshot]types.ContainerJSON, logs io.Writer) error {
+	var replacements []*replacement
+	for _, snap := range group {
+		old := containers[snap]
+		name := strings.TrimPrefix(old.Name, "/")
+		fmt.Fprintf(logs, "Replacing %s..\n", name)
+		r, err := startReplacement(ctx, dockerClient, old, snap, logs)
+		if err != nil {
+			err = fmt.Errorf("replace %s: %w", name, err)
+			for _, r := range replacements {
+				err = r.rollbackWithError(err)
+			}
+			return err
+		}
+		replacements = append(replacements, r)
+	}
+
+	for _, r := range replacements {
+		if err := r.commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startReplacement stops the old container, and boots the snapshot in its
+// place. If the snapshot fails to become ready, the old container is
+// restored.
+func startReplacement(ctx context.Context, dockerClient DockerClient, old types.ContainerJSON, snap *Snapshot,
+	logs io.Writer) (_ *replacement, err error) {
+	r := &replacement{
+		client:     dockerClient,
+		old:        old,
+		name:       strings.TrimPrefix(old.Name, "/"),
+		wasRunning: old.State != nil && old.State.Running,
+	}
+
+	// Docker deletes containers started with --rm once they stop, so the
+	// old container couldn't be restored if the replacement failed.
+	if autoRemoves(old) {
+		return nil, errors.New("containers started with --rm can't be replaced, since stopping " +
+			"them deletes them")
+	}
+
+	// Move the old container out of the way so that the new container can
+	// take its name and ports.
+	if err := dockerClient.ContainerStop(ctx, old.ID, nil); err != nil {
+		return nil, fmt.Errorf("stop old container: %w", err)
+	}
+
+	backupName := fmt.Sprintf("%s-dksnap-backup-%d", r.name, time.Now().Unix())
+	if err := dockerClient.ContainerRename(ctx, old.ID, backupName); err != nil {
+		err = fmt.Errorf("rename old container: %w", err)
+		if r.wasRunning {
+			cleanupCtx, cancel := CleanupContext()
+			defer cancel()
+			if startErr := dockerClient.ContainerStart(cleanupCtx, old.ID, types.ContainerStartOptions{}); startErr != nil {
+				err = fmt.Errorf("%w (failed to restart old container: %s)", err, startErr)
+			}
+		}
+		return nil, err
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		err = r.rollbackWithError(err)
+	}()
+
+	// Copy the config so that the caller's inspect result, which rollback
+	// also relies on, isn't modified.
+	containerConfig := *old.Config
+	containerConfig.Labels = map[string]string{}
+	for key, value := range old.Config.Labels {
+		containerConfig.Labels[key] = value
+	}
+	containerConfig.Image = snap.ImageID
+	if len(snap.ImageNames) > 0 {
+		containerConfig.Image = snap.ImageNames[0]
+	}
+
+	// Force the container to use the snapshot's entrypoint.
+	containerConfig.Entrypoint = nil
+
+	// Newer versions of docker-compose track the image that the container was
+	// created from, and recreate containers whose image doesn't match.
+	if _, ok := containerConfig.Labels[composeImageLabel]; ok {
+		containerConfig.Labels[composeImageLabel] = snap.ImageID
+	}
+
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: old.NetworkSettings.Networks,
+	}
+	createdContainer, err := dockerClient.ContainerCreate(ctx, &containerConfig, old.HostConfig, networkingConfig,
+		r.name)
+	if err != nil {
+		return nil, fmt.Errorf("create new container: %w", err)
+	}
+	r.newID = createdContainer.ID
+
+	// The new container may reuse the old container's volumes, which could
+	// have already been restored from this snapshot. Force the snapshot's
+	// data to be restored so that the volumes don't keep the old data.
+	if err := MarkForReset(ctx, dockerClient, r.newID); err != nil {
+		return nil, fmt.Errorf("mark new container for reset: %w", err)
+	}
+
+	// Once the new container starts, it may overwrite the shared volumes.
+	r.started = true
+	err = dockerClient.ContainerStart(ctx, r.newID, types.ContainerStartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("start new container: %w", err)
+	}
+
+	fmt.Fprintln(logs, "Waiting for the new container to become ready..")
+	readyCtx, cancel := context.WithTimeout(ctx, ReadyTimeout)
+	defer cancel()
+	if err := WaitReady(readyCtx, dockerClient, r.newID, snap.ReadinessProbe, logs); err != nil {
+		return nil, fmt.Errorf("new container failed to become ready: %w", err)
+	}
+	return r, nil
+}
+
+// commit finishes the replacement by removing the old container.
+func (r *replacement) commit(ctx context.Context) error {
+	err := r.client.ContainerRemove(ctx, r.old.ID, types.ContainerRemoveOptions{
+		Force: true,
+	})
+	if err != nil {
+		return fmt.Errorf("remove old container: %w", err)
+	}
+	return nil
+}
+
+// rollbackWithError rolls back the replacement after it failed with err, and
+// returns err annotated with the outcome of the rollback.
+func (r *replacement) rollbackWithError(err error) error {
+	if rollbackErr := r.rollback(); rollbackErr != nil {
+		return fmt.Errorf("%w (failed to restore old container %s: %s)", err, r.name, rollbackErr)
+	}
+
+	if shared := sharedMounts(r.old); r.started && len(shared) != 0 {
+		return fmt.Errorf("%w (restored old container %s, but volumes aren't rolled back, so %s may "+
+			"contain the snapshot's data)", err, r.name, strings.Join(shared, ", "))
+	}
+	return fmt.Errorf("%w (restored old container %s)", err, r.name)
+}
+
+// sharedMounts returns the named volumes and host directories that are
+// mounted by the container, and so are also mounted by its replacement.
+// Anonymous volumes aren't shared since the replacement gets new ones.
+func sharedMounts(container types.ContainerJSON) []string {
+	named := map[string]bool{}
+	if container.ContainerJSONBase != nil && container.HostConfig != nil {
+		for _, bind := range container.HostConfig.Binds {
+			named[strings.SplitN(bind, ":", 2)[0]] = true
+		}
+		for _, mount := range container.HostConfig.Mounts {
+			named[mount.Source] = true
+		}
+	}
+
+	var shared []string
+	for _, mount := range container.Mounts {
+		switch {
+		case mount.Type == mountTypes.TypeBind:
+			shared = append(shared, mount.Source)
+		case mount.Type == mountTypes.TypeVolume && named[mount.Name]:
+			shared = append(shared, mount.Name)
+		}
+	}
+	return shared
+}
+
+// rollback undoes the replacement by removing the new container, and
+// restoring the name and state of the old container.
+func (r *replacement) rollback() error {
+	ctx, cancel := CleanupContext()
+	defer cancel()
+
+	if r.newID != "" {
+		err := r.client.ContainerRemove(ctx, r.newID, types.ContainerRemoveOptions{
+			Force: true,
+		})
+		if err != nil {
+			return fmt.Errorf("remove new container: %w", err)
+		}
+	}
+
+	if err := r.client.ContainerRename(ctx, r.old.ID, r.name); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	if r.wasRunning {
+		if err := r.client.ContainerStart(ctx, r.old.ID, types.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+	}
+	return nil
+}
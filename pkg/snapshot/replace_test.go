@@ -0,0 +1,132 @@
+package snapshot
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+
+	"github.com/kelda/dksnap/pkg/fakedocker"
+)
+
+// contextClient fails the calls used to roll back replacements once their
+// context is done, like the real Docker client does.
+type contextClient struct {
+	*fakedocker.Client
+}
+
+func (c contextClient) ContainerRemove(ctx context.Context, container string,
+	options types.ContainerRemoveOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.ContainerRemove(ctx, container, options)
+}
+
+func (c contextClient) ContainerRename(ctx context.Context, container, newName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.ContainerRename(ctx, container, newName)
+}
+
+func (c contextClient) ContainerStart(ctx context.Context, container string,
+	options types.ContainerStartOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Client.ContainerStart(ctx, container, options)
+}
+
+func TestReplaceRollbackAfterCancel(t *testing.T) {
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"},
+		&containerTypes.HostConfig{Binds: []string{"pgdata:/var/lib/postgresql/data"}})
+	snap := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Postgres Snapshot")
+
+	// The caller's context expires while waiting for the new container, but
+	// the old container should still be restored.
+	db.notReady = true
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := Replace(ctx, contextClient{client}, container, snap, ioutil.Discard)
+	if err == nil {
+		t.Fatal("replace succeeded even though the new container never became ready")
+	}
+
+	// The new container shared the old container's volume, which isn't
+	// rolled back.
+	if !strings.Contains(err.Error(), "volumes aren't rolled back, so pgdata") {
+		t.Errorf("error doesn't warn about the shared volume: %s", err)
+	}
+
+	restored, err := client.ContainerInspect(context.Background(), "db")
+	if err != nil {
+		t.Fatalf("old container wasn't restored: %s", err)
+	}
+	if restored.ID != container.ID {
+		t.Errorf("db is %s, expected the old container %s", restored.ID, container.ID)
+	}
+	if !restored.State.Running {
+		t.Errorf("old container wasn't restarted")
+	}
+}
+
+func TestReplaceAutoRemove(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	snap := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Postgres Snapshot")
+
+	// Stopping the old container would delete it, so it couldn't be
+	// restored if the replacement failed.
+	temporary := runContainer(t, client, "temporary", &containerTypes.Config{Image: "postgres:12"},
+		&containerTypes.HostConfig{AutoRemove: true})
+	if err := Replace(ctx, client, temporary, snap, ioutil.Discard); err == nil {
+		t.Fatal("replacing a --rm container succeeded")
+	}
+
+	temporary, err := client.ContainerInspect(ctx, "temporary")
+	if err != nil {
+		t.Fatalf("container was lost: %s", err)
+	}
+	if !temporary.State.Running {
+		t.Errorf("container was left stopped")
+	}
+}
+
+func TestReplaceKeepsCallerConfig(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{
+		Image:  "postgres:12",
+		Labels: map[string]string{composeImageLabel: "sha256:original"},
+	}, nil)
+	snap := createSnapshot(t, client, NewPostgres(client, "postgres"), container, "Postgres Snapshot")
+
+	if err := Replace(ctx, client, container, snap, ioutil.Discard); err != nil {
+		t.Fatalf("replace: %s", err)
+	}
+
+	// The caller's inspect result describes the old container, so it
+	// shouldn't be modified.
+	if container.Config.Image != "postgres:12" || len(container.Config.Entrypoint) == 0 ||
+		container.Config.Labels[composeImageLabel] != "sha256:original" {
+		t.Errorf("replace modified the caller's config: %+v", container.Config)
+	}
+
+	replaced, err := client.ContainerInspect(ctx, "db")
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+	if replaced.Config.Labels[composeImageLabel] != snap.ImageID {
+		t.Errorf("compose image label wasn't updated: %v", replaced.Config.Labels)
+	}
+}
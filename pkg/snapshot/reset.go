@@ -0,0 +1,87 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// MarkForReset makes the next boot of a container booted from a snapshot
+// restore the snapshot's data, even if it was already restored. Without it,
+// the data is only restored the first time the container boots with a
+// volume.
+func MarkForReset(ctx context.Context, dockerClient DockerClient, containerID string) error {
+	var resetTar bytes.Buffer
+	tw := tar.NewWriter(&resetTar)
+	err := tw.WriteHeader(&tar.Header{
+		Name:    filepath.Base(resetPath),
+		Mode:    0644,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("write reset file: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("write reset file: %w", err)
+	}
+
+	err = dockerClient.CopyToContainer(ctx, containerID, filepath.Dir(resetPath), &resetTar,
+		types.CopyToContainerOptions{})
+	if err != nil {
+		return fmt.Errorf("copy reset file: %w", err)
+	}
+	return nil
+}
+
+// Reset wipes the data written to a container since it was booted from a
+// snapshot by restarting it with the snapshot's data. It blocks until the
+// container is ready again, and streams the container's logs to logs while
+// waiting.
+func Reset(ctx context.Context, dockerClient DockerClient, containerID string, logs io.Writer) error {
+	containerInfo, err := dockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("inspect container: %w", err)
+	}
+
+	imageInfo, _, err := dockerClient.ImageInspectWithRaw(ctx, containerInfo.Image)
+	if err != nil {
+		return fmt.Errorf("inspect image: %w", err)
+	}
+
+	var labels map[string]string
+	if imageInfo.Config != nil {
+		labels = imageInfo.Config.Labels
+	}
+	if _, ok := labels[TitleLabel]; !ok {
+		return fmt.Errorf("container %s wasn't booted from a snapshot",
+			strings.TrimPrefix(containerInfo.Name, "/"))
+	}
+
+	var probe []string
+	if probeJSON := labels[ReadinessProbeLabel]; probeJSON != "" {
+		if err := json.Unmarshal([]byte(probeJSON), &probe); err != nil {
+			return fmt.Errorf("malformed readiness probe value %s: %w", probeJSON, err)
+		}
+	}
+
+	if err := MarkForReset(ctx, dockerClient, containerID); err != nil {
+		return err
+	}
+
+	if err := dockerClient.ContainerRestart(ctx, containerID, nil); err != nil {
+		return fmt.Errorf("restart container: %w", err)
+	}
+
+	if err := WaitReady(ctx, dockerClient, containerID, probe, logs); err != nil {
+		return fmt.Errorf("container failed to become ready: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package snapshot
+
+import (
+	"sort"
+
+	"github.com/docker/docker/api/types"
+)
+
+// getRunConfig returns the configuration needed to recreate the container.
+func getRunConfig(container types.ContainerJSON) RunConfig {
+	var runConfig RunConfig
+	if container.Config != nil {
+		runConfig.Env = container.Config.Env
+		runConfig.Cmd = container.Config.Cmd
+	}
+
+	if container.HostConfig != nil {
+		runConfig.NetworkMode = string(container.HostConfig.NetworkMode)
+		runConfig.RestartPolicy = container.HostConfig.RestartPolicy.Name
+		runConfig.MaxRetries = container.HostConfig.RestartPolicy.MaximumRetryCount
+
+		for port, bindings := range container.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				runConfig.Ports = append(runConfig.Ports, PortBinding{
+					ContainerPort: string(port),
+					HostIP:        binding.HostIP,
+					HostPort:      binding.HostPort,
+				})
+			}
+		}
+		sort.Slice(runConfig.Ports, func(i, j int) bool {
+			return runConfig.Ports[i].ContainerPort < runConfig.Ports[j].ContainerPort
+		})
+	}
+
+	if container.NetworkSettings != nil {
+		for name, endpoint := range container.NetworkSettings.Networks {
+			network := Network{Name: name}
+			if endpoint != nil {
+				for _, alias := range endpoint.Aliases {
+					// Docker automatically aliases containers by their short
+					// ID, which won't match the new container.
+					if len(container.ID) >= 12 && alias == container.ID[:12] {
+						continue
+					}
+					network.Aliases = append(network.Aliases, alias)
+				}
+			}
+			runConfig.Networks = append(runConfig.Networks, network)
+		}
+
+		// Sort the networks so that the network matching the network mode
+		// comes first, since containers can only be created with a single
+		// network.
+		sort.Slice(runConfig.Networks, func(i, j int) bool {
+			iPrimary := runConfig.Networks[i].Name == runConfig.NetworkMode
+			jPrimary := runConfig.Networks[j].Name == runConfig.NetworkMode
+			if iPrimary != jPrimary {
+				return iPrimary
+			}
+			return runConfig.Networks[i].Name < runConfig.Networks[j].Name
+		})
+	}
+	return runConfig
+}
@@ -0,0 +1,197 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// SchemaVersion is the version of the label schema written by this version of
+// dksnap. It's only bumped when existing labels change meaning or are
+// removed, since only then do old snapshots need to be migrated.
+//
+// Version 1 only tracked the title, creation time, dump path, and base
+// entrypoint. Version 2 added the source container, snapshotter, engine
+// version, captured mounts, and host.
+//
+// Version 2 is additive-only. Later releases added the source volume,
+// exclude patterns, data checksums, readiness probe, group, schedule, run
+// configuration, consistency mode, and fallback labels, as well as the
+// description, tags, and pinned labels set when snapshots are edited.
+// Snapshots created by earlier releases don't have them, so they're all
+// optional, and missing labels are parsed as their zero values.
+const SchemaVersion = 2
+
+// errNewerSchema is returned when parsing snapshots created by a newer
+// version of dksnap.
+var errNewerSchema = errors.New("the schema version is newer than this version of dksnap supports")
+
+// snapshotterByDumpPath is used to infer the snapshotter of version 1
+// snapshots, which didn't record it.
+var snapshotterByDumpPath = map[string]string{
+	"":                                     "generic",
+	"/dksnap-dump.sql":                     "postgres",
+	"/dksnap/dump.archive":                 "mongo",
+	"/docker-entrypoint-initdb.d/dump.sql": "mysql",
+}
+
+// parseSnapshot parses the snapshot metadata stored in the image's labels.
+func parseSnapshot(img types.ImageSummary) (*Snapshot, error) {
+	version := 1
+	if versionStr, ok := img.Labels[SchemaVersionLabel]; ok {
+		var err error
+		version, err = strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("malformed schema version %s: %w", versionStr, err)
+		}
+	}
+
+	var snap *Snapshot
+	var err error
+	switch version {
+	case 1:
+		snap, err = parseV1Labels(img.Labels)
+	case 2:
+		snap, err = parseV2Labels(img.Labels)
+	default:
+		return nil, fmt.Errorf("image %s uses schema version %d: %w", img.ID, version, errNewerSchema)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snap.SchemaVersion = version
+	snap.ImageID = img.ID
+	snap.ImageNames = img.RepoTags
+	return snap, nil
+}
+
+func parseV1Labels(labels map[string]string) (*Snapshot, error) {
+	var snap Snapshot
+	created, err := time.Parse(time.RFC3339, labels[CreatedLabel])
+	if err != nil {
+		return nil, err
+	}
+	snap.Created = created
+	snap.Title = labels[TitleLabel]
+	snap.DumpPath = labels[DumpPathLabel]
+	snap.Snapshotter = snapshotterByDumpPath[snap.DumpPath]
+	return &snap, nil
+}
+
+func parseV2Labels(labels map[string]string) (*Snapshot, error) {
+	snap, err := parseV1Labels(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	snap.Source = Source{
+		ContainerName:  labels[SourceContainerNameLabel],
+		ContainerID:    labels[SourceContainerIDLabel],
+		ComposeProject: labels[ComposeProjectLabel],
+		ComposeService: labels[ComposeServiceLabel],
+		Volume:         labels[SourceVolumeLabel],
+	}
+	if snapshotter, ok := labels[SnapshotterLabel]; ok {
+		snap.Snapshotter = snapshotter
+	}
+	snap.Fallback = labels[FallbackLabel] == "true"
+	snap.GroupID = labels[GroupLabel]
+	snap.Schedule = labels[ScheduleLabel]
+	snap.Consistency = Consistency(labels[ConsistencyLabel])
+	snap.EngineVersion = labels[EngineVersionLabel]
+	snap.Host = labels[HostLabel]
+	snap.Description = labels[DescriptionLabel]
+	snap.Pinned = labels[PinnedLabel] == "true"
+	snap.DumpChecksum = labels[DumpChecksumLabel]
+	snap.Exclude = ParseExcludePatterns(labels[ExcludeLabel])
+	if probeJSON := labels[ReadinessProbeLabel]; probeJSON != "" {
+		if err := json.Unmarshal([]byte(probeJSON), &snap.ReadinessProbe); err != nil {
+			return nil, fmt.Errorf("malformed readiness probe value %s: %w", probeJSON, err)
+		}
+	}
+	if checksumsJSON := labels[VolumeChecksumsLabel]; checksumsJSON != "" {
+		if err := json.Unmarshal([]byte(checksumsJSON), &snap.VolumeChecksums); err != nil {
+			return nil, fmt.Errorf("malformed volume checksums value %s: %w", checksumsJSON, err)
+		}
+	}
+	if tagsJSON := labels[TagsLabel]; tagsJSON != "" {
+		if err := json.Unmarshal([]byte(tagsJSON), &snap.Tags); err != nil {
+			return nil, fmt.Errorf("malformed tags value %s: %w", tagsJSON, err)
+		}
+	}
+	if runConfigJSON := labels[RunConfigLabel]; runConfigJSON != "" {
+		if err := json.Unmarshal([]byte(runConfigJSON), &snap.RunConfig); err != nil {
+			return nil, fmt.Errorf("malformed run config value %s: %w", runConfigJSON, err)
+		}
+	}
+	if mountsJSON, ok := labels[MountsLabel]; ok {
+		if err := json.Unmarshal([]byte(mountsJSON), &snap.Mounts); err != nil {
+			return nil, fmt.Errorf("malformed mounts value %s: %w", mountsJSON, err)
+		}
+	}
+	return snap, nil
+}
+
+// Migrate rewrites the labels of a snapshot created by an older version of
+// dksnap so that they match the current schema. It's a no-op for snapshots
+// that are already up to date.
+func Migrate(ctx context.Context, dockerClient DockerClient, snap *Snapshot) error {
+	if snap.BaseImage || snap.SchemaVersion >= SchemaVersion {
+		return nil
+	}
+
+	// relabel upgrades the schema of the labels as part of the rebuild.
+	return relabel(ctx, dockerClient, snap, map[string]string{})
+}
+
+// migrationLabels returns the labels that upgrade the snapshot to the current
+// schema version.
+func migrationLabels(snap *Snapshot) map[string]string {
+	// Version 2 only added labels, so we just need to fill in the values that
+	// can be inferred from the version 1 labels.
+	return map[string]string{
+		SchemaVersionLabel: strconv.Itoa(SchemaVersion),
+		SnapshotterLabel:   snap.Snapshotter,
+	}
+}
+
+// relabel changes the labels of a snapshot. Docker labels are immutable, so
+// the labels are set by a thin image built on top of the snapshot. The
+// snapshot's image names are then moved to the new image. Snapshots using an
+// older schema are upgraded to the current schema as part of the rebuild.
+func relabel(ctx context.Context, dockerClient DockerClient, snap *Snapshot, labels map[string]string) error {
+	if len(snap.ImageNames) == 0 {
+		return fmt.Errorf("snapshot %s has no image names", snap.ImageID)
+	}
+
+	buildContext, err := ioutil.TempDir("", "dksnap-context")
+	if err != nil {
+		return fmt.Errorf("make build context dir: %w", err)
+	}
+	defer os.RemoveAll(buildContext)
+
+	if snap.SchemaVersion < SchemaVersion {
+		for k, v := range migrationLabels(snap) {
+			if _, ok := labels[k]; !ok {
+				labels[k] = v
+			}
+		}
+	}
+
+	var buildInstructions []string
+	for k, v := range labels {
+		buildInstructions = append(buildInstructions, fmt.Sprintf("LABEL %q=%q", k, v))
+	}
+	buildInstructions = append(buildInstructions,
+		fmt.Sprintf("LABEL %q=%q", SupersedesLabel, snap.ImageID))
+
+	return runBuild(ctx, dockerClient, buildContext, snap.ImageID, buildInstructions, snap.ImageNames)
+}
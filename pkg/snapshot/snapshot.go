@@ -4,18 +4,22 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	mountTypes "github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 )
 
@@ -23,64 +27,73 @@ import (
 // commit`, and creating a tarball for each attached volume. The new
 // container's entrypoint is then modified to load the volumes at boot.
 type Generic struct {
-	client *client.Client
+	client DockerClient
 }
 
 // NewGeneric creates a new generic snapshotter.
-func NewGeneric(c *client.Client) Snapshotter {
+func NewGeneric(c DockerClient) Snapshotter {
 	return &Generic{c}
 }
 
 // Create creates a new snapshot.
-func (c *Generic) Create(ctx context.Context, container types.ContainerJSON, title, imageName string) error {
+func (c *Generic) Create(ctx context.Context, container types.ContainerJSON, opts CreateOptions) (err error) {
 	buildContext, err := ioutil.TempDir("", "dksnap-context")
 	if err != nil {
 		return fmt.Errorf("make build context dir: %w", err)
 	}
 	defer os.RemoveAll(buildContext)
 
-	var buildInstructions, bootCommands []string
-	for i, mount := range container.Mounts {
-		// Skip host volumes so that we don't affect the files in them when we
-		// load the snapshot later.
-		if mount.Type == mountTypes.TypeBind {
-			continue
-		}
+	exclude := mergeExcludePatterns(opts.Exclude,
+		ParseExcludePatterns(getContainerLabel(container, ExcludeLabel)))
+	if err := ValidateExcludePatterns(exclude); err != nil {
+		return err
+	}
 
-		volumeTarReader, _, err := c.client.CopyFromContainer(ctx, container.ID, mount.Destination)
-		if err != nil {
-			return fmt.Errorf("dump volume %s: %w", mount.Destination, err)
-		}
+	consistency := opts.Consistency
+	if consistency == "" {
+		consistency = ConsistencyLive
+	}
 
-		volumeTarFile, err := ioutil.TempFile(buildContext, "dksnap-volume")
-		if err != nil {
-			return fmt.Errorf("create volume dump %s: %w", mount.Destination, err)
+	resume, err := c.freeze(ctx, container.ID, consistency)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if resumeErr := resume(); resumeErr != nil && err == nil {
+			err = resumeErr
+		}
+	}()
+
+	var buildInstructions []string
+	var bootCommands []bootCommand
+	var mounts []Mount
+	volumeChecksums := map[string]string{}
+	for i, mount := range ContainerMounts(container) {
+		if !shouldCapture(mount, opts.Mounts) {
+			continue
 		}
 
-		if _, err := io.Copy(volumeTarFile, volumeTarReader); err != nil {
-			return fmt.Errorf("write volume dump %s: %w", mount.Destination, err)
+		stagePath := fmt.Sprintf("/dksnap/%d.tar", i)
+		tarName, volumeChecksum, err := stageVolume(ctx, c.client, container.ID, mount.Destination, buildContext,
+			exclude)
+		if err != nil {
+			return err
 		}
+		volumeChecksums[stagePath] = volumeChecksum
 
-		stagePath := fmt.Sprintf("/dksnap/%d", i)
-		buildInstructions = append(buildInstructions,
-			fmt.Sprintf("ADD %s %s", filepath.Base(volumeTarFile.Name()), stagePath))
+		buildInstructions = append(buildInstructions, fmt.Sprintf("COPY %s %s", tarName, stagePath))
 
-		bootCommand := fmt.Sprintf(`
-# Load %[1]s.
-snapshotPath="%[2]s"
-volumePath="%[1]s"
-if [ ! -d "${volumePath}" ]; then
-  mkdir -p "${volumePath}"
-fi
-
-rm -rf ${volumePath}/*
-cp -R "${snapshotPath}/." "${volumePath}/.."
-`, mount.Destination, stagePath)
-		bootCommands = append(bootCommands, bootCommand)
+		bootCommands = append(bootCommands, bootCommand{
+			description: fmt.Sprintf("Load %s.", mount.Destination),
+			marker:      filepath.Join(mount.Destination, restoreMarker),
+			script:      volumeRestoreScript(mount.Destination, stagePath),
+		})
+		mounts = append(mounts, mount)
 	}
 
 	fsCommit, err := c.client.ContainerCommit(ctx, container.ID, types.ContainerCommitOptions{
-		Pause: true,
+		Pause:   true,
+		Changes: []string{fmt.Sprintf("LABEL %s=commit %s=%q", HelperLabel, HelperOwnerLabel, helperOwner())},
 	})
 	if err != nil {
 		return fmt.Errorf("commit container: %w", err)
@@ -91,8 +104,13 @@ cp -R "${snapshotPath}/." "${volumePath}/.."
 		context:           buildContext,
 		buildInstructions: buildInstructions,
 		bootCommands:      bootCommands,
-		title:             title,
-		imageNames:        []string{imageName},
+		createOptions:     opts,
+		container:         container,
+		snapshotter:       "generic",
+		mounts:            mounts,
+		volumeChecksums:   volumeChecksums,
+		consistency:       consistency,
+		exclude:           exclude,
 	})
 	if err != nil {
 		return fmt.Errorf("build image: %w", err)
@@ -100,17 +118,258 @@ cp -R "${snapshotPath}/." "${volumePath}/.."
 	return nil
 }
 
+// restoreMarker is the name of the file that records which snapshot the
+// data in a volume was restored from.
+const restoreMarker = ".dksnap-restored"
+
+// resetPath is the path of the file that forces the next boot of a container
+// to restore the snapshot's data, even if it was already restored.
+const resetPath = "/dksnap/reset"
+
+// bootCommand restores data when a container is booted from a snapshot.
+//
+// Each command only runs once per volume, so that restarting the container,
+// or recreating it with the same volume, doesn't throw away the data written
+// since the snapshot was restored. This is tracked by a marker file within
+// the restored volume that contains the ID of the restored snapshot.
+type bootCommand struct {
+	description string
+	script      string
+
+	// marker is the path of the file that records that the data was
+	// restored. It should be within the volume being restored.
+	marker string
+
+	// markAfterInit is set when the marker can only be written after the
+	// database has been initialized, since the database refuses to
+	// initialize into a non-empty directory. The marker is then written by a
+	// docker-entrypoint-initdb.d script.
+	markAfterInit bool
+}
+
+// freeze stops the container from writing to its filesystem and volumes
+// according to the consistency mode. It returns a function that resumes the
+// container once it has been captured, even if ctx was cancelled. Containers
+// that are already stopped or paused are left as is.
+func (c *Generic) freeze(ctx context.Context, containerID string, consistency Consistency) (func() error, error) {
+	noop := func() error { return nil }
+	if consistency == ConsistencyLive {
+		return noop, nil
+	}
+
+	containerInfo, err := c.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("inspect container: %w", err)
+	}
+	if containerInfo.State == nil || !containerInfo.State.Running || containerInfo.State.Paused {
+		return noop, nil
+	}
+
+	switch consistency {
+	case ConsistencyPause:
+		if err := c.client.ContainerPause(ctx, containerID); err != nil {
+			return nil, fmt.Errorf("pause container: %w", err)
+		}
+		return func() error {
+			// Resume the container even if the snapshot was cancelled.
+			ctx, cancel := CleanupContext()
+			defer cancel()
+			if err := c.client.ContainerUnpause(ctx, containerID); err != nil {
+				return fmt.Errorf("unpause container: %w", err)
+			}
+			return nil
+		}, nil
+	case ConsistencyStop:
+		if err := CheckConsistency(containerInfo, consistency); err != nil {
+			return nil, err
+		}
+		if err := c.client.ContainerStop(ctx, containerID, nil); err != nil {
+			return nil, fmt.Errorf("stop container: %w", err)
+		}
+		return func() error {
+			ctx, cancel := CleanupContext()
+			defer cancel()
+			if err := c.client.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+				return fmt.Errorf("restart container: %w", err)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown consistency mode %q", consistency)
+	}
+}
+
+// CheckConsistency returns an error if the consistency mode can't be used to
+// snapshot the container.
+func CheckConsistency(container types.ContainerJSON, consistency Consistency) error {
+	// Docker deletes containers started with --rm once they stop, so they
+	// couldn't be started again.
+	if consistency == ConsistencyStop && autoRemoves(container) {
+		return errors.New("the stop consistency mode can't be used with containers " +
+			"started with --rm, since stopping them deletes them")
+	}
+	return nil
+}
+
+// autoRemoves returns whether Docker deletes the container once it stops.
+func autoRemoves(container types.ContainerJSON) bool {
+	return container.ContainerJSONBase != nil && container.HostConfig != nil && container.HostConfig.AutoRemove
+}
+
+// ContainerMounts returns the mounts of the container that the generic
+// snapshotter can capture.
+func ContainerMounts(container types.ContainerJSON) []Mount {
+	var mounts []Mount
+	for _, mount := range container.Mounts {
+		captured := Mount{
+			Type:        string(mount.Type),
+			Name:        mount.Name,
+			Destination: mount.Destination,
+		}
+		if mount.Type == mountTypes.TypeBind {
+			captured.Source = mount.Source
+		}
+		mounts = append(mounts, captured)
+	}
+
+	// Mounts created with --tmpfs aren't included in the container's mounts.
+	if container.ContainerJSONBase != nil && container.HostConfig != nil {
+		var tmpfsPaths []string
+		for path := range container.HostConfig.Tmpfs {
+			tmpfsPaths = append(tmpfsPaths, path)
+		}
+		sort.Strings(tmpfsPaths)
+
+		for _, path := range tmpfsPaths {
+			mounts = append(mounts, Mount{
+				Type:        string(mountTypes.TypeTmpfs),
+				Destination: path,
+			})
+		}
+	}
+	return mounts
+}
+
+// CapturedByDefault returns whether the generic snapshotter captures the
+// mount when the mounts aren't explicitly chosen. Bind mounts are skipped so
+// that we don't affect the files on the host when we load the snapshot later,
+// and tmpfs mounts are skipped since they usually hold scratch data.
+func CapturedByDefault(mount Mount) bool {
+	return mount.Type != string(mountTypes.TypeBind) && mount.Type != string(mountTypes.TypeTmpfs)
+}
+
+func shouldCapture(mount Mount, chosen []string) bool {
+	if chosen == nil {
+		return CapturedByDefault(mount)
+	}
+
+	for _, destination := range chosen {
+		if filepath.Clean(destination) == filepath.Clean(mount.Destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// stageVolume copies the contents of the volume mounted at the given path
+// into a tarball in the build context, skipping the files that match the
+// exclude patterns. It returns the name of the tarball within the build
+// context, and the checksum of its contents.
+//
+// The raw tarball should be staged in the image rather than letting Docker
+// extract it so that the ownership, permissions, timestamps, and hardlinks of
+// the files are restored exactly.
+func stageVolume(ctx context.Context, dockerClient DockerClient, containerID, path, buildContext string,
+	exclude []string) (string, string, error) {
+	volumeTarReader, stat, err := dockerClient.CopyFromContainer(ctx, containerID, path)
+	if err != nil {
+		return "", "", fmt.Errorf("dump volume %s: %w", path, err)
+	}
+	defer volumeTarReader.Close()
+
+	// The restore script replaces the contents of a directory, so single
+	// files that are bind mounted can't be restored.
+	if !stat.Mode.IsDir() {
+		return "", "", fmt.Errorf("dump volume %s: only directories can be captured", path)
+	}
+
+	volumeTarFile, err := ioutil.TempFile(buildContext, "dksnap-volume")
+	if err != nil {
+		return "", "", fmt.Errorf("create volume dump %s: %w", path, err)
+	}
+	defer volumeTarFile.Close()
+
+	// Only rewrite the tarball when necessary, so that the files are staged
+	// exactly as Docker archived them.
+	if len(exclude) == 0 {
+		_, err = io.Copy(volumeTarFile, volumeTarReader)
+	} else {
+		err = filterTar(volumeTarFile, volumeTarReader, exclude)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("write volume dump %s: %w", path, err)
+	}
+
+	if _, err := volumeTarFile.Seek(0, io.SeekStart); err != nil {
+		return "", "", fmt.Errorf("rewind volume dump %s: %w", path, err)
+	}
+
+	volumeChecksum, err := tarChecksum(volumeTarFile)
+	if err != nil {
+		return "", "", fmt.Errorf("checksum volume dump %s: %w", path, err)
+	}
+	return filepath.Base(volumeTarFile.Name()), volumeChecksum, nil
+}
+
+// volumeRestoreScript returns the shell script that replaces the contents of
+// the volume with the tarball staged in the image.
+func volumeRestoreScript(volumePath, stagePath string) string {
+	return fmt.Sprintf(`snapshotPath="%[2]s"
+volumePath="%[1]s"
+mkdir -p "${volumePath}"
+rm -rf "${volumePath}"/* "${volumePath}"/.[!.]* "${volumePath}"/..?*
+
+# The tarball's top level directory is the volume directory. Prefer restoring
+# extended attributes, but fall back for tar implementations that don't
+# support them, such as BusyBox.
+parentPath="$(dirname "${volumePath}")"
+tar --xattrs --xattrs-include='*' --numeric-owner -xpf "${snapshotPath}" -C "${parentPath}" 2>/dev/null ||
+  tar --numeric-owner -xpf "${snapshotPath}" -C "${parentPath}"`, volumePath, stagePath)
+}
+
 type buildOptions struct {
 	baseImage         string
 	context           string
 	buildInstructions []string
-	bootCommands      []string
-	title             string
-	imageNames        []string
+	bootCommands      []bootCommand
 	dumpPath          string
+
+	// Metadata about how the snapshot was created.
+	createOptions CreateOptions
+	container     types.ContainerJSON
+	snapshotter   string
+	engineVersion string
+	mounts        []Mount
+	consistency   Consistency
+
+	// exclude are the patterns of the files that weren't captured from the
+	// mounts.
+	exclude []string
+
+	// volume is the name of the volume that was snapshotted by the volume
+	// snapshotter.
+	volume string
+
+	// readinessProbe is the command that checks whether a container booted
+	// from the snapshot is ready.
+	readinessProbe []string
+
+	// Checksums used to verify the integrity of the snapshot's data.
+	dumpChecksum    string
+	volumeChecksums map[string]string
 }
 
-func buildImage(ctx context.Context, dockerClient *client.Client, opts buildOptions) error {
+func buildImage(ctx context.Context, dockerClient DockerClient, opts buildOptions) error {
 	baseImageInfo, _, err := dockerClient.ImageInspectWithRaw(ctx, opts.baseImage)
 	if err != nil {
 		return fmt.Errorf("get base image info: %w", err)
@@ -126,12 +385,53 @@ func buildImage(ctx context.Context, dockerClient *client.Client, opts buildOpti
 	// Add a script that first runs the boot commands, then runs the
 	// original entrypoint.
 	if len(opts.bootCommands) != 0 {
+		restoreID, err := newRestoreID()
+		if err != nil {
+			return fmt.Errorf("generate restore ID: %w", err)
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(opts.context, "restore-id"), []byte(restoreID), 0644); err != nil {
+			return fmt.Errorf("write restore ID: %w", err)
+		}
+
+		var guardedCommands, initMarkers []string
+		for _, cmd := range opts.bootCommands {
+			markCommand := fmt.Sprintf(`cat /dksnap/restore-id > %q`, cmd.marker)
+			if cmd.markAfterInit {
+				initMarkers = append(initMarkers, markCommand)
+				markCommand = ""
+			}
+
+			// The command runs in a subshell that exits on the first error so
+			// that the marker is only written if the restore succeeded.
+			// Otherwise, the container exits rather than booting with
+			// partially restored data, and the restore is retried on the next
+			// boot. The subshell's status is checked separately since `set -e`
+			// has no effect within an `if` condition.
+			guardedCommands = append(guardedCommands, fmt.Sprintf(`# %s
+if [ -e %[2]q ] || [ "$(cat %[3]q 2>/dev/null)" != "$(cat /dksnap/restore-id)" ]; then
+  rm -f %[3]q
+  (
+    set -e
+%[4]s
+  )
+  if [ $? -ne 0 ]; then
+    echo %[5]q >&2
+    exit 1
+  fi
+fi`, cmd.description, resetPath, cmd.marker, indent(indent(strings.TrimSpace(cmd.script+"\n"+markCommand))),
+				"dksnap: failed to restore the snapshot: "+cmd.description))
+		}
+
 		bootScript := fmt.Sprintf(`#!/bin/sh
 %s
 
+rm -f %q
+
 exec %s "$@"
 `,
-			strings.Join(opts.bootCommands, "\n\n"),
+			strings.Join(guardedCommands, "\n\n"),
+			resetPath,
 			strings.Join(quoteStrings(baseEntrypoint), " "))
 
 		if err := ioutil.WriteFile(filepath.Join(opts.context, "entrypoint.sh"), []byte(bootScript), 0755); err != nil {
@@ -139,9 +439,21 @@ exec %s "$@"
 		}
 
 		opts.buildInstructions = append(opts.buildInstructions,
+			"COPY restore-id /dksnap/restore-id",
 			"COPY entrypoint.sh /dksnap/entrypoint.sh",
 			`ENTRYPOINT ["/dksnap/entrypoint.sh"]`)
 
+		if len(initMarkers) != 0 {
+			// Sort after the scripts that load the dump so that the marker is
+			// only written once the data has been loaded.
+			markScript := "#!/bin/sh\n" + strings.Join(initMarkers, "\n") + "\n"
+			if err := ioutil.WriteFile(filepath.Join(opts.context, "mark-restored.sh"), []byte(markScript), 0755); err != nil {
+				return fmt.Errorf("write restore marker script: %w", err)
+			}
+			opts.buildInstructions = append(opts.buildInstructions,
+				"COPY mark-restored.sh /docker-entrypoint-initdb.d/zz-dksnap-mark-restored.sh")
+		}
+
 		// Docker discards the original CMD when the entrypoint is changed, so
 		// we need to copy it over explicitly.
 		quotedCmds := quoteStrings(baseImageInfo.Config.Cmd)
@@ -154,31 +466,102 @@ exec %s "$@"
 		return fmt.Errorf("marshal entrypoint: %w", err)
 	}
 
+	mountsJSON, err := json.Marshal(opts.mounts)
+	if err != nil {
+		return fmt.Errorf("marshal mounts: %w", err)
+	}
+
+	volumeChecksumsJSON, err := json.Marshal(opts.volumeChecksums)
+	if err != nil {
+		return fmt.Errorf("marshal volume checksums: %w", err)
+	}
+
+	readinessProbeJSON, err := json.Marshal(opts.readinessProbe)
+	if err != nil {
+		return fmt.Errorf("marshal readiness probe: %w", err)
+	}
+
+	// Volume snapshots aren't created from a container, so they don't have a
+	// run configuration.
+	var runConfigJSON []byte
+	if opts.container.Config != nil {
+		runConfigJSON, err = json.Marshal(getRunConfig(opts.container))
+		if err != nil {
+			return fmt.Errorf("marshal run config: %w", err)
+		}
+	}
+
+	// The hostname is purely informational, so don't fail the snapshot if
+	// it's unavailable.
+	host, _ := os.Hostname()
+
 	for k, v := range map[string]string{
-		TitleLabel:          opts.title,
-		DumpPathLabel:       opts.dumpPath,
-		CreatedLabel:        time.Now().Format(time.RFC3339),
-		BaseEntrypointLabel: string(baseEntrypointJSON),
+		SchemaVersionLabel:       strconv.Itoa(SchemaVersion),
+		TitleLabel:               opts.createOptions.Title,
+		DumpPathLabel:            opts.dumpPath,
+		CreatedLabel:             time.Now().Format(time.RFC3339),
+		BaseEntrypointLabel:      string(baseEntrypointJSON),
+		SourceContainerNameLabel: strings.TrimPrefix(opts.container.Name, "/"),
+		SourceContainerIDLabel:   opts.container.ID,
+		ComposeProjectLabel:      getContainerLabel(opts.container, composeProjectLabel),
+		ComposeServiceLabel:      getContainerLabel(opts.container, composeServiceLabel),
+		SourceVolumeLabel:        opts.volume,
+		SnapshotterLabel:         opts.snapshotter,
+		FallbackLabel:            strconv.FormatBool(opts.createOptions.Fallback),
+		GroupLabel:               opts.createOptions.GroupID,
+		ScheduleLabel:            opts.createOptions.Schedule,
+		ConsistencyLabel:         string(opts.consistency),
+		EngineVersionLabel:       opts.engineVersion,
+		MountsLabel:              string(mountsJSON),
+		ExcludeLabel:             strings.Join(opts.exclude, ","),
+		HostLabel:                host,
+		DumpChecksumLabel:        opts.dumpChecksum,
+		VolumeChecksumsLabel:     string(volumeChecksumsJSON),
+		ReadinessProbeLabel:      string(readinessProbeJSON),
+		RunConfigLabel:           string(runConfigJSON),
+
+		// Clear labels inherited from the base image that only apply to
+		// the base image.
+		SupersedesLabel:  "",
+		DescriptionLabel: "",
+		TagsLabel:        "",
+		PinnedLabel:      "",
+		HelperLabel:      "",
+		HelperOwnerLabel: "",
 	} {
 		opts.buildInstructions = append(opts.buildInstructions, fmt.Sprintf("LABEL %q=%q", k, v))
 	}
 
+	return runBuild(ctx, dockerClient, opts.context, opts.baseImage, opts.buildInstructions,
+		[]string{opts.createOptions.ImageName})
+}
+
+// runBuild builds an image from the given base image and Dockerfile
+// instructions, and tags it with the given image names. The build context is
+// read from the contextDir directory.
+func runBuild(ctx context.Context, dockerClient DockerClient, contextDir, baseImage string,
+	buildInstructions, imageNames []string) error {
 	dockerfile := fmt.Sprintf(`
 FROM %s
 %s
-`, opts.baseImage, strings.Join(opts.buildInstructions, "\n"))
+`, baseImage, strings.Join(buildInstructions, "\n"))
 
-	if err := ioutil.WriteFile(filepath.Join(opts.context, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(contextDir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
 		return fmt.Errorf("write Dockerfile: %w", err)
 	}
 	var buildContextTar bytes.Buffer
-	if err := makeTar(&buildContextTar, opts.context); err != nil {
+	if err := makeTar(&buildContextTar, contextDir); err != nil {
 		return fmt.Errorf("tar build context: %w", err)
 	}
 
 	buildResp, err := dockerClient.ImageBuild(ctx, &buildContextTar, types.ImageBuildOptions{
 		Dockerfile: "Dockerfile",
-		Tags:       opts.imageNames,
+		Tags:       imageNames,
+
+		// Don't leave the intermediate containers of each build step
+		// behind, even if the build fails.
+		Remove:      true,
+		ForceRemove: true,
 	})
 	if err != nil {
 		return fmt.Errorf("start build: %w", err)
@@ -237,6 +620,32 @@ func makeTar(writer io.Writer, dir string) error {
 	return err
 }
 
+func getContainerLabel(container types.ContainerJSON, key string) string {
+	if container.Config == nil {
+		return ""
+	}
+	return container.Config.Labels[key]
+}
+
+// indent indents each non-empty line of the shell script.
+func indent(script string) string {
+	lines := strings.Split(script, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "  " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func newRestoreID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
 func quoteStrings(strs []string) (quoted []string) {
 	for _, str := range strs {
 		quoted = append(quoted, fmt.Sprintf("%q", str))
@@ -0,0 +1,153 @@
+//go:build !windows
+// +build !windows
+
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var fixtureModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// fixtureEntry describes a file in the volume fixture.
+type fixtureEntry struct {
+	header  tar.Header
+	content string
+}
+
+// volumeFixture returns the files of a volume with unusual ownership and
+// special files, in the format returned by `docker cp`.
+func volumeFixture() []fixtureEntry {
+	return []fixtureEntry{
+		{header: tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0700, Uid: 999, Gid: 999}},
+		{header: tar.Header{Name: "data/owned", Typeflag: tar.TypeReg, Mode: 0640, Uid: 1234, Gid: 5678},
+			content: "owned by a user that doesn't exist"},
+		{header: tar.Header{Name: "data/.hidden", Typeflag: tar.TypeReg, Mode: 0600, Uid: 70, Gid: 70},
+			content: "hidden"},
+		{header: tar.Header{Name: "data/setuid", Typeflag: tar.TypeReg, Mode: 04755},
+			content: "#!/bin/sh\n"},
+		{header: tar.Header{Name: "data/sticky/", Typeflag: tar.TypeDir, Mode: 01777}},
+		{header: tar.Header{Name: "data/link", Typeflag: tar.TypeSymlink, Linkname: "owned", Mode: 0777,
+			Uid: 1234, Gid: 5678}},
+		{header: tar.Header{Name: "data/hardlink", Typeflag: tar.TypeLink, Linkname: "data/owned"}},
+		{header: tar.Header{Name: "data/fifo", Typeflag: tar.TypeFifo, Mode: 0620, Uid: 33, Gid: 33}},
+	}
+}
+
+func writeFixtureTar(t *testing.T, path string) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, entry := range volumeFixture() {
+		header := entry.header
+		header.ModTime = fixtureModTime
+		header.Size = int64(len(entry.content))
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatalf("write header %s: %s", header.Name, err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("write %s: %s", header.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar: %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write fixture: %s", err)
+	}
+}
+
+func TestVolumeRestoreScript(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("restoring ownership requires root")
+	}
+	if _, err := osexec.LookPath("tar"); err != nil {
+		t.Skip("tar isn't installed")
+	}
+
+	dir, err := ioutil.TempDir("", "dksnap-restore-test")
+	if err != nil {
+		t.Fatalf("make temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stagePath := filepath.Join(dir, "0.tar")
+	writeFixtureTar(t, stagePath)
+
+	// The restore should replace any existing files in the volume.
+	volumePath := filepath.Join(dir, "volume", "data")
+	if err := os.MkdirAll(volumePath, 0755); err != nil {
+		t.Fatalf("make volume: %s", err)
+	}
+	for _, name := range []string{"stale", ".stale", "..stale"} {
+		if err := ioutil.WriteFile(filepath.Join(volumePath, name), nil, 0644); err != nil {
+			t.Fatalf("write stale file: %s", err)
+		}
+	}
+
+	out, err := osexec.Command("sh", "-c", volumeRestoreScript(volumePath, stagePath)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("restore script failed: %s\n%s", err, out)
+	}
+
+	for _, name := range []string{"stale", ".stale", "..stale"} {
+		if _, err := os.Lstat(filepath.Join(volumePath, name)); !os.IsNotExist(err) {
+			t.Errorf("stale file %s wasn't removed", name)
+		}
+	}
+
+	for _, entry := range volumeFixture() {
+		expected := entry.header
+		path := filepath.Join(dir, "volume", expected.Name)
+		fi, err := os.Lstat(path)
+		if err != nil {
+			t.Errorf("%s wasn't restored: %s", expected.Name, err)
+			continue
+		}
+
+		if expected.Typeflag == tar.TypeLink {
+			original, err := os.Lstat(filepath.Join(dir, "volume", expected.Linkname))
+			if err != nil {
+				t.Errorf("stat %s: %s", expected.Linkname, err)
+			} else if !os.SameFile(fi, original) {
+				t.Errorf("%s isn't a hardlink to %s", expected.Name, expected.Linkname)
+			}
+			continue
+		}
+
+		stat := fi.Sys().(*syscall.Stat_t)
+		if int(stat.Uid) != expected.Uid || int(stat.Gid) != expected.Gid {
+			t.Errorf("%s is owned by %d:%d, expected %d:%d",
+				expected.Name, stat.Uid, stat.Gid, expected.Uid, expected.Gid)
+		}
+
+		switch expected.Typeflag {
+		case tar.TypeSymlink:
+			target, err := os.Readlink(path)
+			if err != nil || target != expected.Linkname {
+				t.Errorf("%s links to %q (%v), expected %q", expected.Name, target, err, expected.Linkname)
+			}
+			continue
+		case tar.TypeFifo:
+			if fi.Mode()&os.ModeNamedPipe == 0 {
+				t.Errorf("%s isn't a named pipe", expected.Name)
+			}
+		case tar.TypeReg:
+			if !fi.ModTime().Equal(fixtureModTime) {
+				t.Errorf("%s was modified at %s, expected %s", expected.Name, fi.ModTime(), fixtureModTime)
+			}
+		}
+
+		if mode := int64(stat.Mode & 07777); mode != expected.Mode {
+			t.Errorf("%s has mode %o, expected %o", expected.Name, mode, expected.Mode)
+		}
+	}
+}
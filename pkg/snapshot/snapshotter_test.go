@@ -0,0 +1,325 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+func TestGenericCreate(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDocker(&postgresDB{})
+	client.AddVolume("app-data", map[string]string{
+		"/users.json":       `["kevin"]`,
+		"/uploads/logo.png": "png",
+	})
+
+	container := runContainer(t, client, "app", &containerTypes.Config{Image: "app"},
+		&containerTypes.HostConfig{
+			Binds: []string{"app-data:/var/lib/app"},
+			Tmpfs: map[string]string{"/tmp": ""},
+		})
+	if err := client.WriteFile("app", "/app/config.json", []byte("{}")); err != nil {
+		t.Fatalf("write config: %s", err)
+	}
+
+	snap := createSnapshot(t, client, NewGeneric(client), container, "Generic Snapshot")
+
+	if snap.Snapshotter != "generic" || snap.Fallback {
+		t.Errorf("unexpected snapshotter %q (fallback %t)", snap.Snapshotter, snap.Fallback)
+	}
+	if snap.Source.ContainerName != "app" || snap.Source.ContainerID != container.ID {
+		t.Errorf("unexpected source %+v", snap.Source)
+	}
+
+	// The tmpfs mount isn't captured by default.
+	expMounts := []Mount{{Type: "volume", Name: "app-data", Destination: "/var/lib/app"}}
+	if !reflect.DeepEqual(snap.Mounts, expMounts) {
+		t.Errorf("captured mounts %+v, expected %+v", snap.Mounts, expMounts)
+	}
+
+	// The container's filesystem is committed, and the volume is staged as
+	// a tarball.
+	config, err := client.ReadImageFile(snap.ImageID, "/app/config.json")
+	if err != nil || string(config) != "{}" {
+		t.Errorf("config wasn't committed: %q (%v)", config, err)
+	}
+
+	stagedTar, err := client.ReadImageFile(snap.ImageID, "/dksnap/0.tar")
+	if err != nil {
+		t.Fatalf("read staged volume: %s", err)
+	}
+	expNames := []string{"app/", "app/uploads/", "app/uploads/logo.png", "app/users.json"}
+	if names := tarNames(t, stagedTar); !reflect.DeepEqual(names, expNames) {
+		t.Errorf("staged volume contains %v, expected %v", names, expNames)
+	}
+
+	// The snapshot restores the volume before running the original
+	// entrypoint.
+	image, _, err := client.ImageInspectWithRaw(ctx, snap.ImageID)
+	if err != nil {
+		t.Fatalf("inspect snapshot: %s", err)
+	}
+	if entrypoint := []string(image.Config.Entrypoint); !reflect.DeepEqual(entrypoint, []string{"/dksnap/entrypoint.sh"}) {
+		t.Errorf("unexpected entrypoint %v", entrypoint)
+	}
+	if cmd := []string(image.Config.Cmd); !reflect.DeepEqual(cmd, []string{"--port", "8080"}) {
+		t.Errorf("the original command wasn't kept: %v", cmd)
+	}
+	if image.Config.Labels["maintainer"] != "kelda" {
+		t.Errorf("labels from the original image weren't kept: %v", image.Config.Labels)
+	}
+	if helper := image.Config.Labels[HelperLabel]; helper != "" {
+		t.Errorf("snapshot inherited the helper label %q", helper)
+	}
+
+	bootScript, err := client.ReadImageFile(snap.ImageID, "/dksnap/entrypoint.sh")
+	if err != nil {
+		t.Fatalf("read entrypoint: %s", err)
+	}
+	for _, exp := range []string{`snapshotPath="/dksnap/0.tar"`, `volumePath="/var/lib/app"`, "set -e", `exec "/app/server" "$@"`} {
+		if !strings.Contains(string(bootScript), exp) {
+			t.Errorf("entrypoint doesn't contain %q:\n%s", exp, bootScript)
+		}
+	}
+
+	results, err := Verify(ctx, client, snap)
+	if err != nil {
+		t.Fatalf("verify: %s", err)
+	}
+	if len(results) != 1 || !results[0].OK() {
+		t.Errorf("snapshot failed verification: %+v", results)
+	}
+	assertNoHelperContainers(t, client)
+}
+
+func TestPostgresCreate(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{
+		Image: "postgres:12",
+		Env:   []string{"POSTGRES_USER=kelda"},
+	}, nil)
+
+	dbs := DetectDatabases(ctx, client, container)
+	if dbs != (Databases{Postgres: true}) {
+		t.Fatalf("detected %+v, expected Postgres", dbs)
+	}
+
+	snapshotter := NewSnapshotter(client, container, dbs, SelectOptions{})
+	snap := createSnapshot(t, client, snapshotter, container, "Postgres Snapshot")
+
+	if db.dumpedFrom != container.ID || db.dumpUser != "kelda" {
+		t.Errorf("dumped %s as %s, expected %s as kelda", db.dumpedFrom, db.dumpUser, container.ID)
+	}
+	if snap.Snapshotter != "postgres" {
+		t.Errorf("unexpected snapshotter %q", snap.Snapshotter)
+	}
+	if snap.EngineVersion != "postgres (PostgreSQL) 12.1" {
+		t.Errorf("unexpected engine version %q", snap.EngineVersion)
+	}
+	if snap.DumpChecksum != checksum([]byte(db.dump)) {
+		t.Errorf("unexpected dump checksum %q", snap.DumpChecksum)
+	}
+	if !reflect.DeepEqual(snap.ReadinessProbe, []string{"pg_isready", "-h", "127.0.0.1"}) {
+		t.Errorf("unexpected readiness probe %v", snap.ReadinessProbe)
+	}
+
+	dump, err := client.ReadImageFile(snap.ImageID, snap.DumpPath)
+	if err != nil || string(dump) != db.dump {
+		t.Errorf("unexpected dump %q (%v)", dump, err)
+	}
+	if _, err := client.ReadImageFile(snap.ImageID, "/docker-entrypoint-initdb.d/load-dump.sh"); err != nil {
+		t.Errorf("missing load script: %s", err)
+	}
+	assertNoHelperContainers(t, client)
+}
+
+func TestPostgresCreateStopped(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n"}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"},
+		&containerTypes.HostConfig{Binds: []string{"pgdata:/var/lib/postgresql/data"}})
+	if err := client.ContainerStop(ctx, container.ID, nil); err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	container, err := client.ContainerInspect(ctx, container.ID)
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+
+	// Stopped containers are snapshotted generically unless DumpStopped is
+	// set.
+	dbs := DetectDatabases(ctx, client, container)
+	if _, ok := NewSnapshotter(client, container, dbs, SelectOptions{}).(*Generic); !ok {
+		t.Errorf("stopped container wasn't snapshotted generically")
+	}
+
+	snapshotter := NewSnapshotter(client, container, dbs, SelectOptions{DumpStopped: true})
+	snap := createSnapshot(t, client, snapshotter, container, "Stopped Snapshot")
+	if snap.Snapshotter != "postgres" {
+		t.Errorf("unexpected snapshotter %q", snap.Snapshotter)
+	}
+
+	// The database is dumped from a temporary copy of the container, which
+	// is removed afterwards.
+	if db.dumpedFrom == "" || db.dumpedFrom == container.ID {
+		t.Errorf("database wasn't dumped from a temporary container")
+	}
+	if db.dumpUser != "postgres" {
+		t.Errorf("dumped as %s, expected the default user", db.dumpUser)
+	}
+	assertNoHelperContainers(t, client)
+
+	container, err = client.ContainerInspect(ctx, container.ID)
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+	if container.State.Running {
+		t.Errorf("the stopped container was started")
+	}
+}
+
+func TestCreateWithFallback(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{failDump: true}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+
+	var fallbackErr error
+	snapshotter := NewSnapshotter(client, container, DetectDatabases(ctx, client, container), SelectOptions{})
+	err := CreateWithFallback(ctx, client, snapshotter, container,
+		CreateOptions{Title: "Fallback", ImageName: "fallback"},
+		func(err error) { fallbackErr = err })
+	if err != nil {
+		t.Fatalf("create: %s", err)
+	}
+
+	if fallbackErr == nil || !strings.Contains(fallbackErr.Error(), "connection refused") {
+		t.Errorf("unexpected fallback error %v", fallbackErr)
+	}
+
+	snap := findSnapshot(t, client, "fallback")
+	if snap.Snapshotter != "generic" || !snap.Fallback {
+		t.Errorf("unexpected snapshotter %q (fallback %t)", snap.Snapshotter, snap.Fallback)
+	}
+	if snap.DumpPath != "" {
+		t.Errorf("generic snapshot has a dump %q", snap.DumpPath)
+	}
+}
+
+func tarNames(t *testing.T, tarball []byte) []string {
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(tarball))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("read tar: %s", err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func assertNoHelperContainers(t *testing.T, client DockerClient) {
+	helpers, err := client.ContainerList(context.Background(), types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", HelperLabel)),
+	})
+	if err != nil {
+		t.Fatalf("list helper containers: %s", err)
+	}
+	for _, helper := range helpers {
+		t.Errorf("helper container %s (%s) wasn't removed", helper.Names[0], helper.Labels[HelperLabel])
+	}
+}
+
+func TestGenericCreateStopAutoRemove(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeDocker(&postgresDB{})
+	container := runContainer(t, client, "app", &containerTypes.Config{Image: "app"},
+		&containerTypes.HostConfig{AutoRemove: true})
+
+	// Stopping the container would delete it, so the snapshot is refused
+	// rather than losing the container.
+	err := NewGeneric(client).Create(ctx, container, CreateOptions{
+		Title:       "Stopped Snapshot",
+		ImageName:   ImageNameForTitle("Stopped Snapshot"),
+		Consistency: ConsistencyStop,
+	})
+	if err == nil {
+		t.Fatal("snapshotting a --rm container with the stop consistency mode succeeded")
+	}
+
+	container, err = client.ContainerInspect(ctx, "app")
+	if err != nil {
+		t.Fatalf("container was lost: %s", err)
+	}
+	if !container.State.Running {
+		t.Errorf("container was left stopped")
+	}
+}
+
+func TestGenericCreateStopResumesAfterCancel(t *testing.T) {
+	client := newFakeDocker(&postgresDB{})
+	container := runContainer(t, client, "app", &containerTypes.Config{Image: "app"}, nil)
+
+	// The container is started again even though the snapshot's context was
+	// cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	NewGeneric(contextClient{client}).Create(ctx, container, CreateOptions{
+		Title:       "Stopped Snapshot",
+		ImageName:   ImageNameForTitle("Stopped Snapshot"),
+		Consistency: ConsistencyStop,
+	})
+
+	container, err := client.ContainerInspect(context.Background(), "app")
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+	if !container.State.Running {
+		t.Errorf("container was left stopped")
+	}
+}
+
+func TestPostgresCreateStoppedRemovesAfterCancel(t *testing.T) {
+	ctx := context.Background()
+	db := &postgresDB{dump: "CREATE TABLE users;\n", notReady: true}
+	client := newFakeDocker(db)
+	container := runContainer(t, client, "db", &containerTypes.Config{Image: "postgres:12"}, nil)
+	if err := client.ContainerStop(ctx, container.ID, nil); err != nil {
+		t.Fatalf("stop: %s", err)
+	}
+	container, err := client.ContainerInspect(ctx, container.ID)
+	if err != nil {
+		t.Fatalf("inspect: %s", err)
+	}
+
+	// The temporary container never becomes ready, so the snapshot's context
+	// expires, but the temporary container should still be removed.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = NewPostgres(contextClient{client}, "postgres").Create(timeoutCtx, container, CreateOptions{
+		Title:     "Stopped Snapshot",
+		ImageName: ImageNameForTitle("Stopped Snapshot"),
+	})
+	if err == nil {
+		t.Fatal("create succeeded even though the temporary container never became ready")
+	}
+	assertNoHelperContainers(t, client)
+}
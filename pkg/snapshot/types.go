@@ -2,6 +2,7 @@ package snapshot
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -11,14 +12,102 @@ import (
 // may make assumptions about the type of container that is being snapshotted.
 // For example, the Postgres snapshotter shells out to `pg_dumpall`.
 type Snapshotter interface {
-	Create(ctx context.Context, container types.ContainerJSON, title, imageName string) error
+	Create(ctx context.Context, container types.ContainerJSON, opts CreateOptions) error
 }
 
+// CreateOptions contains the user provided settings for a new snapshot.
+type CreateOptions struct {
+	Title     string
+	ImageName string
+
+	// Fallback is set when the snapshot is being created by the generic
+	// snapshotter because the database aware snapshotter failed.
+	Fallback bool
+
+	// GroupID is set when the snapshot is part of a group of snapshots that
+	// were taken together.
+	GroupID string
+
+	// Consistency controls how the generic snapshotter keeps the
+	// container's filesystem and volumes consistent while capturing them.
+	// It defaults to ConsistencyLive.
+	Consistency Consistency
+
+	// Mounts are the destinations of the mounts captured by the generic
+	// snapshotter. If it's nil, the mounts that are captured by default are
+	// captured. See CapturedByDefault.
+	Mounts []string
+
+	// Exclude are glob patterns for files within the captured mounts that
+	// the generic snapshotter skips, such as caches and logs. See
+	// ParseExcludePatterns for the pattern syntax. The patterns in the
+	// container's ExcludeLabel are also skipped.
+	Exclude []string
+
+	// Schedule is the name of the schedule or rule that created the
+	// snapshot, if it was created automatically.
+	Schedule string
+}
+
+// Consistency is a strategy for capturing a container's filesystem and
+// volumes at the same moment.
+type Consistency string
+
 const (
+	// ConsistencyLive captures the volumes while the container keeps
+	// running, and only pauses it while committing its filesystem. Files
+	// written during the capture may be torn.
+	ConsistencyLive Consistency = "live"
+
+	// ConsistencyPause pauses the container for the entire capture.
+	ConsistencyPause Consistency = "pause"
+
+	// ConsistencyStop stops the container for the entire capture, and starts
+	// it again afterwards. Unlike pausing, this gives the application a
+	// chance to flush its data to disk. It can't be used with containers
+	// started with --rm, since Docker deletes them once they stop.
+	ConsistencyStop Consistency = "stop"
+)
+
+// ParseConsistency parses the name of a consistency mode.
+func ParseConsistency(name string) (Consistency, error) {
+	switch mode := Consistency(name); mode {
+	case ConsistencyLive, ConsistencyPause, ConsistencyStop:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown consistency mode %q", name)
+	}
+}
+
+const (
+	// SchemaVersionLabel is the label added to Docker images to track the
+	// version of the label schema used by the snapshot. Images without the
+	// label use version 1.
+	SchemaVersionLabel = "dksnap.schema-version"
+
+	// SupersedesLabel is the label added to Docker images to track the image
+	// ID of the snapshot that the image replaces. dksnap rewrites labels by
+	// building a thin image on top of the original snapshot, so this is used
+	// to hide the original.
+	SupersedesLabel = "dksnap.supersedes"
+
 	// TitleLabel is the label added to Docker images to track the title of
 	// snapshots.
 	TitleLabel = "dksnap.title"
 
+	// DescriptionLabel is the label added to Docker images to track the
+	// user provided description of snapshots.
+	DescriptionLabel = "dksnap.description"
+
+	// TagsLabel is the label added to Docker images to track the user
+	// provided tags of snapshots. The value is a JSON list of strings.
+	TagsLabel = "dksnap.tags"
+
+	// PinnedLabel is the label added to Docker images to track whether the
+	// snapshot is pinned. Pinned snapshots are protected from being removed
+	// or pruned unless it's forced.
+	PinnedLabel = "dksnap.pinned"
+
 	// CreatedLabel is the label added to Docker images to track the creation
 	// time of snapshots.
 	CreatedLabel = "dksnap.created"
@@ -32,6 +121,109 @@ const (
 	// to injects its boot logic, so we must keep track of the original
 	// entrypoint separately in order for snapshots of snapshots to work.
 	BaseEntrypointLabel = "dksnap.base-entrypoint"
+
+	// SourceContainerNameLabel is the label added to Docker images to track
+	// the name of the container that was snapshotted.
+	SourceContainerNameLabel = "dksnap.source.container-name"
+
+	// SourceContainerIDLabel is the label added to Docker images to track the
+	// ID of the container that was snapshotted.
+	SourceContainerIDLabel = "dksnap.source.container-id"
+
+	// SourceVolumeLabel is the label added to Docker images to track the
+	// name of the volume that was snapshotted by the volume snapshotter.
+	SourceVolumeLabel = "dksnap.source.volume"
+
+	// ComposeProjectLabel is the label added to Docker images to track the
+	// docker-compose project of the container that was snapshotted.
+	ComposeProjectLabel = "dksnap.source.compose-project"
+
+	// ComposeServiceLabel is the label added to Docker images to track the
+	// docker-compose service of the container that was snapshotted.
+	ComposeServiceLabel = "dksnap.source.compose-service"
+
+	// SnapshotterLabel is the label added to Docker images to track which
+	// Snapshotter created the snapshot.
+	SnapshotterLabel = "dksnap.snapshotter"
+
+	// FallbackLabel is the label added to Docker images to track whether the
+	// generic snapshotter was used because the database aware snapshotter
+	// failed.
+	FallbackLabel = "dksnap.fallback"
+
+	// ConsistencyLabel is the label added to Docker images to track how the
+	// generic snapshotter kept the container consistent while capturing it.
+	ConsistencyLabel = "dksnap.consistency"
+
+	// ScheduleLabel is the label added to Docker images to track the name of
+	// the schedule or rule that automatically created the snapshot.
+	ScheduleLabel = "dksnap.schedule"
+
+	// GroupLabel is the label added to Docker images to track the group of
+	// snapshots that were taken together with the snapshot.
+	GroupLabel = "dksnap.group"
+
+	// EngineVersionLabel is the label added to Docker images to track the
+	// version of the database that was dumped.
+	EngineVersionLabel = "dksnap.engine-version"
+
+	// MountsLabel is the label added to Docker images to track the mounts
+	// whose contents were captured in the snapshot.
+	MountsLabel = "dksnap.mounts"
+
+	// ExcludeLabel is the label added to Docker images to track the patterns
+	// of the files that weren't captured from the snapshot's mounts. Users
+	// can also add it to containers to set the patterns that are always
+	// skipped when the container is snapshotted. The value is a comma
+	// separated list of glob patterns.
+	ExcludeLabel = "dksnap.exclude"
+
+	// PreHookLabel and PostHookLabel are labels that users can add to
+	// containers to run a shell command inside the container before and
+	// after it's snapshotted. See Hook.
+	PreHookLabel  = "dksnap.hook.pre"
+	PostHookLabel = "dksnap.hook.post"
+
+	// DumpChecksumLabel is the label added to Docker images to track the
+	// checksum of the database dump.
+	DumpChecksumLabel = "dksnap.dump-checksum"
+
+	// VolumeChecksumsLabel is the label added to Docker images to track the
+	// checksums of the volume contents staged in the image. The value is a JSON
+	// map from the staging path to the checksum.
+	VolumeChecksumsLabel = "dksnap.volume-checksums"
+
+	// ReadinessProbeLabel is the label added to Docker images to track the
+	// command that checks whether the database in a container booted from
+	// the snapshot is ready. The value is a JSON list of strings.
+	ReadinessProbeLabel = "dksnap.readiness-probe"
+
+	// HostLabel is the label added to Docker images to track the host that
+	// created the snapshot.
+	HostLabel = "dksnap.host"
+
+	// RunConfigLabel is the label added to Docker images to track how the
+	// snapshotted container was run. The value is a JSON RunConfig.
+	RunConfigLabel = "dksnap.run-config"
+
+	// HelperLabel is the label added to the temporary containers and
+	// intermediate images that dksnap creates while it works, so that GC can
+	// find the ones that are left behind. The value describes what the
+	// helper is for, such as "commit".
+	HelperLabel = "dksnap.helper"
+
+	// HelperOwnerLabel is the label added to helpers to track the dksnap
+	// process that created them, so that GC doesn't remove the helpers of
+	// processes that are still running. The value has the form
+	// "<hostname>:<pid>".
+	HelperOwnerLabel = "dksnap.helper-owner"
+)
+
+// The labels used by docker-compose to track the containers it owns.
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeImageLabel   = "com.docker.compose.image"
 )
 
 // Snapshot represents a snapshot of a container. It can be booted by running
@@ -42,12 +234,126 @@ type Snapshot struct {
 	// BaseImage is true.
 	BaseImage bool
 
-	Title      string
-	DumpPath   string
-	ImageNames []string
-	Created    time.Time
-	ImageID    string
+	// SchemaVersion is the version of the labels that the snapshot was
+	// parsed from.
+	SchemaVersion int
+
+	Title       string
+	Description string
+	Tags        []string
+	Pinned      bool
+	DumpPath    string
+	ImageNames  []string
+	Created     time.Time
+	ImageID     string
+
+	// Source describes the container that the snapshot was created from.
+	Source Source
+
+	// Snapshotter is the name of the Snapshotter that created the snapshot,
+	// such as "postgres" or "generic".
+	Snapshotter string
+
+	// Fallback is true if the generic snapshotter was used because the
+	// database aware snapshotter failed.
+	Fallback bool
+
+	// GroupID identifies the group of snapshots that were taken together with
+	// this snapshot. It's empty if the snapshot isn't part of a group.
+	GroupID string
+
+	// Consistency is how the container was kept consistent while it was
+	// captured. It's empty for database aware snapshots, which rely on the
+	// consistency of the database dump instead.
+	Consistency Consistency
+
+	// Schedule is the name of the schedule or rule that automatically
+	// created the snapshot. It's empty for snapshots created by users.
+	Schedule string
+
+	// EngineVersion is the version of the database that was dumped. It's
+	// empty for generic snapshots.
+	EngineVersion string
+
+	// Mounts are the mounts whose contents were captured by the snapshot.
+	Mounts []Mount
+
+	// Exclude are the patterns of the files that weren't captured from the
+	// mounts.
+	Exclude []string
+
+	// ReadinessProbe is the command that checks whether the database in a
+	// container booted from the snapshot is ready. It's empty for generic
+	// snapshots.
+	ReadinessProbe []string
+
+	// Host is the hostname of the machine that created the snapshot.
+	Host string
+
+	// DumpChecksum is the checksum of the file at DumpPath.
+	DumpChecksum string
+
+	// VolumeChecksums maps the paths where volume contents are staged within
+	// the image to their checksums.
+	VolumeChecksums map[string]string
+
+	// RunConfig is the configuration of the container that the snapshot was
+	// created from. It's nil for snapshots that didn't record it.
+	RunConfig *RunConfig
+
+	// Size is the disk space used by the snapshot's image. It's calculated
+	// by List.
+	Size DiskUsage
 
 	Parent   *Snapshot
 	Children []*Snapshot
 }
+
+// Source describes the container or volume that a snapshot was created from.
+type Source struct {
+	ContainerName  string
+	ContainerID    string
+	ComposeProject string
+	ComposeService string
+
+	// Volume is the name of the volume that the snapshot was created from.
+	// It's only set for volume snapshots.
+	Volume string
+}
+
+// Mount describes a container mount that was captured by a snapshot.
+type Mount struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+
+	// Source is the path on the host of bind mounts.
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+}
+
+// RunConfig describes how a snapshotted container was run, so that an
+// equivalent container can be booted from the snapshot.
+type RunConfig struct {
+	Env           []string      `json:"env,omitempty"`
+	Cmd           []string      `json:"cmd,omitempty"`
+	Ports         []PortBinding `json:"ports,omitempty"`
+	NetworkMode   string        `json:"networkMode,omitempty"`
+	Networks      []Network     `json:"networks,omitempty"`
+	RestartPolicy string        `json:"restartPolicy,omitempty"`
+	MaxRetries    int           `json:"maxRetries,omitempty"`
+}
+
+// PortBinding describes a container port that was published on the host.
+type PortBinding struct {
+	// ContainerPort is the port and protocol within the container, such as
+	// "5432/tcp".
+	ContainerPort string `json:"containerPort"`
+	HostIP        string `json:"hostIP,omitempty"`
+	HostPort      string `json:"hostPort,omitempty"`
+}
+
+// Network describes a network that a container was connected to.
+type Network struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+}
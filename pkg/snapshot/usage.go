@@ -0,0 +1,104 @@
+package snapshot
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/image"
+)
+
+// DiskUsage describes the disk space used by a snapshot's image. Docker
+// stores the layers that images have in common only once, so removing a
+// snapshot frees at most its Unique size, and nothing if other images are
+// built on top of it.
+type DiskUsage struct {
+	// Unique is the size of the layers that the snapshot added on top of
+	// its parent snapshot, or on top of its base image if it doesn't have a
+	// parent.
+	Unique int64
+
+	// Shared is the size of the layers inherited from the snapshot's
+	// ancestors, not including the base image.
+	Shared int64
+
+	// Base is the size of the base image that the snapshot was built on,
+	// such as the image of the snapshotted container. BaseImageID is the
+	// ID of the base image. Both are empty if the base image isn't tagged
+	// on this machine, in which case its layers are counted as part of
+	// Unique or Shared.
+	Base        int64
+	BaseImageID string
+
+	// Dump and Volumes are the sizes of the database dump and of the staged
+	// volume contents within the Unique layers.
+	Dump    int64
+	Volumes int64
+}
+
+// Total returns the size of the snapshot's entire image.
+func (u DiskUsage) Total() int64 {
+	return u.Unique + u.Shared + u.Base
+}
+
+// volumeStagePattern matches the paths where volume contents are staged
+// within snapshot images.
+var volumeStagePattern = regexp.MustCompile(`^/dksnap/\d+\.tar$`)
+
+// diskUsage calculates the disk usage of the snapshot from its image
+// history, ordered from the newest layer to the oldest. parentIndex is the
+// index of the history entry of the parent snapshot, or len(history) if it
+// doesn't have one. isBase returns whether the image ID refers to a base
+// image.
+func diskUsage(snap *Snapshot, history []image.HistoryResponseItem, parentIndex int,
+	isBase func(imageID string) bool) DiskUsage {
+	var usage DiskUsage
+	for i, layer := range history {
+		if usage.BaseImageID == "" && layer.ID != snap.ImageID && isBase(layer.ID) {
+			usage.BaseImageID = layer.ID
+		}
+
+		switch {
+		case usage.BaseImageID != "":
+			usage.Base += layer.Size
+		case i >= parentIndex:
+			usage.Shared += layer.Size
+		default:
+			usage.Unique += layer.Size
+			for _, dest := range copyDestinations(layer.CreatedBy) {
+				switch {
+				case snap.DumpPath != "" && dest == snap.DumpPath:
+					usage.Dump += layer.Size
+				case volumeStagePattern.MatchString(dest):
+					usage.Volumes += layer.Size
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// copyDestinations returns the absolute paths in the COPY instruction that
+// created a layer, which include its destination. They're parsed from the
+// layer's CreatedBy field, which Docker formats as
+// `/bin/sh -c #(nop) COPY file:<hash> in <dest> `, and BuildKit formats
+// it as `COPY <src> <dest> # buildkit`.
+func copyDestinations(createdBy string) []string {
+	fields := strings.Fields(createdBy)
+	for i, field := range fields {
+		if field != "COPY" {
+			continue
+		}
+
+		var dests []string
+		for _, arg := range fields[i+1:] {
+			if arg == "#" {
+				break
+			}
+			if strings.HasPrefix(arg, "/") {
+				dests = append(dests, arg)
+			}
+		}
+		return dests
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// VerifyResult describes whether a piece of snapshot data still matches the
+// checksum recorded when the snapshot was created.
+type VerifyResult struct {
+	// Path is the location of the data within the snapshot image.
+	Path     string
+	Expected string
+	Actual   string
+}
+
+// OK returns whether the data is unchanged.
+func (r VerifyResult) OK() bool {
+	return r.Expected == r.Actual
+}
+
+// Verify recomputes the checksums of the dump and volume contents stored in
+// the snapshot, and compares them to the checksums recorded when the snapshot
+// was created.
+func Verify(ctx context.Context, dockerClient DockerClient, snap *Snapshot) ([]VerifyResult, error) {
+	if snap.DumpChecksum == "" && len(snap.VolumeChecksums) == 0 {
+		return nil, errors.New("snapshot doesn't have any checksums")
+	}
+
+	var results []VerifyResult
+	if snap.DumpChecksum != "" {
+		dump, err := getFile(ctx, dockerClient, snap.ImageID, snap.DumpPath)
+		if err != nil {
+			return nil, fmt.Errorf("get dump: %w", err)
+		}
+
+		results = append(results, VerifyResult{
+			Path:     snap.DumpPath,
+			Expected: snap.DumpChecksum,
+			Actual:   checksum(dump),
+		})
+	}
+
+	for stagePath, expected := range snap.VolumeChecksums {
+		actual, err := stageChecksum(ctx, dockerClient, snap.ImageID, stagePath)
+		if err != nil {
+			return nil, fmt.Errorf("checksum %s: %w", stagePath, err)
+		}
+
+		results = append(results, VerifyResult{
+			Path:     stagePath,
+			Expected: expected,
+			Actual:   actual,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+func stageChecksum(ctx context.Context, dockerClient DockerClient, image, stagePath string) (string, error) {
+	tarball, cleanup, err := copyFromImage(ctx, dockerClient, image, stagePath)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	defer tarball.Close()
+
+	// The volume's tarball is staged as is, so Docker returns a tarball
+	// containing just the staged tarball.
+	tr := tar.NewReader(tarball)
+	if _, err := tr.Next(); err != nil {
+		return "", fmt.Errorf("read staged tarball: %w", err)
+	}
+	return tarChecksum(tr)
+}
+
+func checksum(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// tarChecksum computes a checksum of the files in a tarball. The checksum
+// depends on the names, owners, permissions, link targets, and contents of
+// the files, but not on the order of the entries or other metadata such as
+// modification times.
+func tarChecksum(r io.Reader) (string, error) {
+	contentHashes := map[string]string{}
+	var entries []string
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		name := strings.Trim(strings.TrimPrefix(header.Name, "./"), "/")
+
+		var desc string
+		switch header.Typeflag {
+		case tar.TypeReg:
+			contentHash := sha256.New()
+			if _, err := io.Copy(contentHash, tr); err != nil {
+				return "", fmt.Errorf("read %s: %w", header.Name, err)
+			}
+			contentHashes[header.Name] = fmt.Sprintf("%x", contentHash.Sum(nil))
+			desc = "file " + contentHashes[header.Name]
+		case tar.TypeLink:
+			// Treat hardlinks the same as regular files so that the
+			// checksum doesn't depend on which link is archived first.
+			desc = "file " + contentHashes[header.Linkname]
+			contentHashes[header.Name] = contentHashes[header.Linkname]
+		case tar.TypeSymlink:
+			desc = "symlink " + header.Linkname
+		case tar.TypeDir:
+			desc = "dir"
+		default:
+			desc = fmt.Sprintf("type %c", header.Typeflag)
+		}
+		entries = append(entries, fmt.Sprintf("%q %d:%d %o %s", name, header.Uid, header.Gid,
+			header.Mode&07777, desc))
+	}
+
+	sort.Strings(entries)
+	return checksum([]byte(strings.Join(entries, "\n"))), nil
+}
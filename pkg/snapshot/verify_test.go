@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+)
+
+func TestTarChecksum(t *testing.T) {
+	makeTar := func(headers ...tar.Header) []byte {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, header := range headers {
+			header := header
+			if err := tw.WriteHeader(&header); err != nil {
+				t.Fatalf("write header: %s", err)
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatalf("close: %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	dir := tar.Header{Name: "data/", Typeflag: tar.TypeDir, Mode: 0700, Uid: 999, Gid: 999}
+	file := tar.Header{Name: "data/PG_VERSION", Typeflag: tar.TypeReg, Mode: 0600, Uid: 999, Gid: 999}
+	link := tar.Header{Name: "data/link", Typeflag: tar.TypeLink, Linkname: "data/PG_VERSION", Mode: 0600,
+		Uid: 999, Gid: 999}
+
+	rootOwned := file
+	rootOwned.Uid, rootOwned.Gid = 0, 0
+	readable := file
+	readable.Mode = 0644
+
+	tests := []struct {
+		name  string
+		x, y  []byte
+		equal bool
+	}{
+		{"identical", makeTar(dir, file, link), makeTar(dir, file, link), true},
+		{"reordered", makeTar(dir, file, link), makeTar(file, link, dir), true},
+		{"owner", makeTar(dir, file), makeTar(dir, rootOwned), false},
+		{"mode", makeTar(dir, file), makeTar(dir, readable), false},
+		{"missing", makeTar(dir, file), makeTar(dir), false},
+	}
+	for _, test := range tests {
+		x, err := tarChecksum(bytes.NewReader(test.x))
+		if err != nil {
+			t.Fatalf("%s: checksum: %s", test.name, err)
+		}
+		y, err := tarChecksum(bytes.NewReader(test.y))
+		if err != nil {
+			t.Fatalf("%s: checksum: %s", test.name, err)
+		}
+		if (x == y) != test.equal {
+			t.Errorf("%s: checksums %s and %s, expected equal: %t", test.name, x, y, test.equal)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	containerTypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// helperImage is the image used by the helper containers that access
+// volumes that aren't attached to a container.
+const helperImage = "busybox:1.31"
+
+// volumeMountPath is where volumes are mounted in helper containers, and in
+// the images of volume snapshots.
+const volumeMountPath = "/volume"
+
+// Volume creates snapshots of named volumes, such as volumes left behind by
+// `docker-compose down`. The volume is mounted into a helper container, and
+// captured the same way as the generic snapshotter captures volumes.
+//
+// The snapshot's image restores its contents into the volume mounted at
+// /volume when it's run, so it can be restored with RestoreVolume, or with
+// `docker run --rm -v VOLUME:/volume SNAPSHOT`.
+type Volume struct {
+	client DockerClient
+}
+
+// NewVolume creates a new volume snapshotter.
+func NewVolume(c DockerClient) *Volume {
+	return &Volume{c}
+}
+
+// Create creates a new snapshot of the given volume.
+func (c *Volume) Create(ctx context.Context, volumeName string, opts CreateOptions) error {
+	volume, err := c.client.VolumeInspect(ctx, volumeName)
+	if err != nil {
+		return fmt.Errorf("inspect volume: %w", err)
+	}
+
+	if err := ValidateExcludePatterns(opts.Exclude); err != nil {
+		return err
+	}
+
+	buildContext, err := ioutil.TempDir("", "dksnap-context")
+	if err != nil {
+		return fmt.Errorf("make build context dir: %w", err)
+	}
+	defer os.RemoveAll(buildContext)
+
+	if err := ensureImage(ctx, c.client, helperImage); err != nil {
+		return fmt.Errorf("get helper image: %w", err)
+	}
+
+	// The helper container doesn't need to be started since Docker can copy
+	// files out of the volumes of stopped containers.
+	helper, err := c.client.ContainerCreate(ctx,
+		&containerTypes.Config{
+			Image:  helperImage,
+			Cmd:    []string{"true"},
+			Labels: helperLabels("volume-snapshot"),
+		},
+		&containerTypes.HostConfig{Binds: []string{volume.Name + ":" + volumeMountPath + ":ro"}},
+		nil, "")
+	if err != nil {
+		return fmt.Errorf("create helper container: %w", err)
+	}
+	defer c.client.ContainerRemove(ctx, helper.ID, types.ContainerRemoveOptions{Force: true})
+
+	stagePath := "/dksnap/0.tar"
+	tarName, volumeChecksum, err := stageVolume(ctx, c.client, helper.ID, volumeMountPath, buildContext,
+		opts.Exclude)
+	if err != nil {
+		return err
+	}
+
+	err = buildImage(ctx, c.client, buildOptions{
+		baseImage:         helperImage,
+		context:           buildContext,
+		buildInstructions: []string{fmt.Sprintf("COPY %s %s", tarName, stagePath)},
+		bootCommands: []bootCommand{{
+			description: "Load the volume.",
+			marker:      volumeMountPath + "/" + restoreMarker,
+			script:      volumeRestoreScript(volumeMountPath, stagePath),
+		}},
+		createOptions: opts,
+		container:     types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{}},
+		snapshotter:   "volume",
+		volume:        volume.Name,
+		mounts: []Mount{{
+			Type:        "volume",
+			Name:        volume.Name,
+			Destination: volumeMountPath,
+		}},
+		volumeChecksums: map[string]string{stagePath: volumeChecksum},
+		exclude:         opts.Exclude,
+	})
+	if err != nil {
+		return fmt.Errorf("build image: %w", err)
+	}
+	return nil
+}
+
+// RestoreVolume replaces the contents of the named volume with the contents
+// of a volume snapshot. The volume is created if it doesn't exist. Volumes
+// that are in use by running containers aren't modified, since the
+// containers could corrupt the restored data.
+func RestoreVolume(ctx context.Context, dockerClient DockerClient, snap *Snapshot, volumeName string) error {
+	if snap.Snapshotter != "volume" {
+		return fmt.Errorf("%q isn't a volume snapshot", snap.Title)
+	}
+
+	users, err := dockerClient.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("volume", volumeName)),
+	})
+	if err != nil {
+		return fmt.Errorf("list containers using volume: %w", err)
+	}
+	if len(users) > 0 {
+		return fmt.Errorf("volume %s is in use by running container %s. Stop it first",
+			volumeName, users[0].Names[0])
+	}
+
+	image := snap.ImageID
+	if len(snap.ImageNames) > 0 {
+		image = snap.ImageNames[0]
+	}
+
+	// Docker automatically creates the volume if it doesn't exist.
+	restorer, err := dockerClient.ContainerCreate(ctx,
+		&containerTypes.Config{
+			Image:  image,
+			Labels: helperLabels("volume-restore"),
+		},
+		&containerTypes.HostConfig{Binds: []string{volumeName + ":" + volumeMountPath}},
+		nil, "")
+	if err != nil {
+		return fmt.Errorf("create restore container: %w", err)
+	}
+	defer dockerClient.ContainerRemove(ctx, restorer.ID, types.ContainerRemoveOptions{Force: true})
+
+	// The volume may have already been restored from this snapshot, so force
+	// the restore to run.
+	if err := MarkForReset(ctx, dockerClient, restorer.ID); err != nil {
+		return err
+	}
+
+	// Start waiting before starting the container so that the exit isn't
+	// missed.
+	waitCh, waitErrCh := dockerClient.ContainerWait(ctx, restorer.ID, containerTypes.WaitConditionNextExit)
+	if err := dockerClient.ContainerStart(ctx, restorer.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("start restore container: %w", err)
+	}
+
+	select {
+	case status := <-waitCh:
+		if status.StatusCode != 0 {
+			tail := &logTail{maxLines: failureLogLines}
+			streamLogs(ctx, dockerClient, restorer.ID, "", false, tail)
+			return fmt.Errorf("restore failed with exit code %d:\n%s", status.StatusCode, tail)
+		}
+		return nil
+	case err := <-waitErrCh:
+		return fmt.Errorf("wait for restore: %w", err)
+	}
+}
+
+// ensureImage pulls the image if it doesn't exist locally.
+func ensureImage(ctx context.Context, dockerClient DockerClient, image string) error {
+	_, _, err := dockerClient.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return err
+	}
+
+	pullStream, err := dockerClient.ImagePull(ctx, image, types.ImagePullOptions{})
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", image, err)
+	}
+	defer pullStream.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(pullStream, ioutil.Discard, 0, false, nil); err != nil {
+		return fmt.Errorf("pull %s: %w", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// pinComposeService makes sure that docker-compose doesn't revert the
+// replaced container to the service's original image. It returns a message
+// describing the result for the user, or an empty string if the container
+// isn't managed by docker-compose.
+func pinComposeService(container Container, snap *snapshot.Snapshot) string {
+	svc, ok := getComposeService(container.ContainerJSON)
+	if !ok {
+		return ""
+	}
+
+	image := snap.ImageID
+	if len(snap.ImageNames) > 0 {
+		image = snap.ImageNames[0]
+	}
+
+	overridePath, err := pinComposeImage(svc, image)
+	if err != nil {
+		return fmt.Sprintf("Failed to pin the %s service to the snapshot, so docker-compose "+
+			"may revert it: %s", svc.service, err)
+	}
+	if !svc.usesDefaultFiles() {
+		return fmt.Sprintf("Wrote %s to pin the %s service to the snapshot, but docker-compose won't "+
+			"load it automatically because the project uses custom compose files. Add `-f %s` after "+
+			"your other -f flags, or docker-compose may revert the service.",
+			overridePath, svc.service, overridePath)
+	}
+	return fmt.Sprintf("Pinned the %s service to the snapshot in %s.", svc.service, overridePath)
+}
+
+// overwrittenBindPaths returns the host paths that will be overwritten with
+// the snapshot's data if the container is replaced or reset with the
+// snapshot. Bind mounts are only captured if the user opted in, so this is
+// usually empty.
+func overwrittenBindPaths(snap *snapshot.Snapshot, container Container) []string {
+	binds := map[string]string{}
+	for _, mount := range container.Mounts {
+		if mount.Type == "bind" {
+			binds[mount.Destination] = mount.Source
+		}
+	}
+
+	var paths []string
+	for _, mount := range snap.Mounts {
+		if mount.Type != "bind" {
+			continue
+		}
+		if source, ok := binds[mount.Destination]; ok {
+			paths = append(paths, source)
+		}
+	}
+	return paths
+}
+
+// overwriteWarning describes the host paths that will be overwritten.
+func overwriteWarning(paths []string) string {
+	return fmt.Sprintf("The following host directories will be overwritten with the snapshot's data:\n%s",
+		strings.Join(paths, "\n"))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/events"
+
+	"github.com/kelda/dksnap/pkg/snapshot"
+)
+
+// The events that can trigger rules.
+const (
+	// triggerStop fires when the container exits, whether it was stopped
+	// or crashed. Docker can't delay the stop, so the container's data is
+	// snapshotted after it exits. Containers that are removed, such as
+	// containers started with --rm, are gone before they can be
+	// snapshotted.
+	triggerStop = "stop"
+
+	// triggerHealthy fires when the container's health check starts
+	// passing.
+	triggerHealthy = "healthy"
+
+	// triggerExec fires when a command run with `docker exec` in the
+	// container exits successfully.
+	triggerExec = "exec"
+)
+
+// snapshotOnLabel lets containers declare the events that trigger snapshots
+// of themselves. The value is a comma separated list of triggers. Exec
+// triggers are written as exec:COMMAND, for example "stop,exec:migrate".
+const snapshotOnLabel = "dksnap.snapshot-on"
+
+// labelRuleName is the name of the rules declared with snapshotOnLabel.
+const labelRuleName = "label"
+
+// daemonRule is a parsed ruleConfig.
+type daemonRule struct {
+	*automation
+	on         string
+	containers map[string]bool
+	labelKey   string
+	labelValue *string
+	command    string
+}
+
+func newDaemonRule(config ruleConfig) (*daemonRule, error) {
+	a, err := newAutomation("rule", config.automationConfig, defaultRuleTitleTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stopping the container would trigger more events, and possibly more
+	// snapshots.
+	if a.consistency == snapshot.ConsistencyStop {
+		return nil, fmt.Errorf("rule %q: rules can't use the stop consistency mode", config.Name)
+	}
+
+	r := &daemonRule{
+		automation: a,
+		on:         config.On,
+		containers: map[string]bool{},
+		command:    config.Command,
+	}
+	switch config.On {
+	case triggerStop, triggerHealthy:
+	case triggerExec:
+		if config.Command == "" {
+			return nil, fmt.Errorf("rule %q: exec rules require a command", config.Name)
+		}
+	default:
+		return nil, fmt.Errorf("rule %q: unknown event %q. Expected %s, %s, or %s",
+			config.Name, config.On, triggerStop, triggerHealthy, triggerExec)
+	}
+
+	if len(config.Containers) == 0 && config.Label == "" {
+		return nil, fmt.Errorf("rule %q: either containers or a label is required", config.Name)
+	}
+	for _, name := range config.Containers {
+		r.containers[name] = true
+	}
+
+	if config.Label != "" {
+		parts := strings.SplitN(config.Label, "=", 2)
+		r.labelKey = parts[0]
+		if len(parts) == 2 {
+			r.labelValue = &parts[1]
+		}
+	}
+	return r, nil
+}
+
+// appliesTo returns whether the rule selects the container described by the
+// attributes of one of its events. Docker includes the container's name and
+// labels in the attributes.
+func (r *daemonRule) appliesTo(attributes map[string]string) bool {
+	if r.containers[attributes["name"]] {
+		return true
+	}
+
+	if r.labelKey == "" {
+		return false
+	}
+	value, ok := attributes[r.labelKey]
+	return ok && (r.labelValue == nil || *r.labelValue == value)
+}
+
+// matches returns whether the event triggers the rule.
+func (r *daemonRule) matches(event ruleEvent) bool {
+	if r.on != event.trigger || !r.appliesTo(event.attributes) {
+		return false
+	}
+	return r.on != triggerExec || runsCommand(event.command, r.command)
+}
+
+// labelRules returns the rules that the container declared with
+// snapshotOnLabel.
+func labelRules(base *automation, attributes map[string]string) []*daemonRule {
+	var rules []*daemonRule
+	for _, trigger := range strings.Split(attributes[snapshotOnLabel], ",") {
+		trigger = strings.TrimSpace(trigger)
+		if trigger == "" {
+			continue
+		}
+
+		r := &daemonRule{
+			automation: base,
+			on:         trigger,
+			containers: map[string]bool{attributes["name"]: true},
+		}
+		if strings.HasPrefix(trigger, triggerExec+":") {
+			r.on = triggerExec
+			r.command = strings.TrimPrefix(trigger, triggerExec+":")
+		}
+
+		// Ignore unknown triggers, and exec triggers without a command,
+		// since labels aren't validated when the container is created.
+		if r.on != triggerStop && r.on != triggerHealthy && (r.on != triggerExec || r.command == "") {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// runsCommand returns whether the command line runs the named executable,
+// either directly or as an argument, such as in `sh -c "npm run migrate"`.
+func runsCommand(commandLine, name string) bool {
+	for _, word := range strings.Fields(commandLine) {
+		if filepath.Base(strings.Trim(word, `"'`)) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleEvent is a Docker event that can trigger rules.
+type ruleEvent struct {
+	trigger     string
+	containerID string
+	attributes  map[string]string
+
+	// command is the command line of the exec, for exec events.
+	command string
+}
+
+// ruleEventActions are the Docker container events that are converted into
+// rule events.
+var ruleEventActions = []string{"die", "health_status", "exec_start", "exec_die"}
+
+// execTracker converts Docker events into rule events. Docker only includes
+// the command in the event for the start of an exec, so it tracks the
+// commands of the running execs.
+type execTracker struct {
+	commands map[string]string
+}
+
+func newExecTracker() *execTracker {
+	return &execTracker{commands: map[string]string{}}
+}
+
+// parse returns the rule event for the Docker event, if there is one.
+func (t *execTracker) parse(e events.Message) (ruleEvent, bool) {
+	event := ruleEvent{
+		containerID: e.Actor.ID,
+		attributes:  e.Actor.Attributes,
+	}
+
+	action := strings.SplitN(e.Action, ":", 2)
+	switch {
+	case action[0] == "die":
+		event.trigger = triggerStop
+		return event, true
+	case action[0] == "health_status" && len(action) == 2 && strings.TrimSpace(action[1]) == "healthy":
+		event.trigger = triggerHealthy
+		return event, true
+	case action[0] == "exec_start" && len(action) == 2:
+		t.commands[e.Actor.Attributes["execID"]] = strings.TrimSpace(action[1])
+		return ruleEvent{}, false
+	case action[0] == "exec_die":
+		execID := e.Actor.Attributes["execID"]
+		command, ok := t.commands[execID]
+		delete(t.commands, execID)
+		if !ok || e.Actor.Attributes["exitCode"] != "0" {
+			return ruleEvent{}, false
+		}
+		event.trigger = triggerExec
+		event.command = command
+		return event, true
+	default:
+		return ruleEvent{}, false
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestExecTrackerParse(t *testing.T) {
+	message := func(action string, attributes map[string]string) events.Message {
+		return events.Message{
+			Action: action,
+			Actor:  events.Actor{ID: "container", Attributes: attributes},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		messages []events.Message
+
+		// exp is the rule event expected for each message, or nil if the
+		// message shouldn't produce one.
+		exp []*ruleEvent
+	}{
+		{
+			name:     "die",
+			messages: []events.Message{message("die", map[string]string{"exitCode": "137"})},
+			exp: []*ruleEvent{{trigger: triggerStop, containerID: "container",
+				attributes: map[string]string{"exitCode": "137"}}},
+		},
+		{
+			name: "health status",
+			messages: []events.Message{
+				message("health_status: unhealthy", nil),
+				message("health_status: healthy", nil),
+			},
+			exp: []*ruleEvent{nil, {trigger: triggerHealthy, containerID: "container"}},
+		},
+		{
+			name: "successful exec",
+			messages: []events.Message{
+				message("exec_start: sh -c npm run migrate", map[string]string{"execID": "1"}),
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "0"}),
+			},
+			exp: []*ruleEvent{nil, {trigger: triggerExec, containerID: "container", command: "sh -c npm run migrate",
+				attributes: map[string]string{"execID": "1", "exitCode": "0"}}},
+		},
+		{
+			name: "failed exec",
+			messages: []events.Message{
+				message("exec_start: migrate", map[string]string{"execID": "1"}),
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "1"}),
+			},
+			exp: []*ruleEvent{nil, nil},
+		},
+		{
+			name: "interleaved execs",
+			messages: []events.Message{
+				message("exec_start: migrate", map[string]string{"execID": "1"}),
+				message("exec_start: seed", map[string]string{"execID": "2"}),
+				message("exec_die", map[string]string{"execID": "2", "exitCode": "0"}),
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "0"}),
+			},
+			exp: []*ruleEvent{nil, nil,
+				{trigger: triggerExec, containerID: "container", command: "seed",
+					attributes: map[string]string{"execID": "2", "exitCode": "0"}},
+				{trigger: triggerExec, containerID: "container", command: "migrate",
+					attributes: map[string]string{"execID": "1", "exitCode": "0"}},
+			},
+		},
+		{
+			name: "exec started before tracking",
+			messages: []events.Message{
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "0"}),
+			},
+			exp: []*ruleEvent{nil},
+		},
+		{
+			name: "exec died twice",
+			messages: []events.Message{
+				message("exec_start: migrate", map[string]string{"execID": "1"}),
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "0"}),
+				message("exec_die", map[string]string{"execID": "1", "exitCode": "0"}),
+			},
+			exp: []*ruleEvent{nil,
+				{trigger: triggerExec, containerID: "container", command: "migrate",
+					attributes: map[string]string{"execID": "1", "exitCode": "0"}},
+				nil,
+			},
+		},
+		{
+			name:     "other action",
+			messages: []events.Message{message("start", nil)},
+			exp:      []*ruleEvent{nil},
+		},
+	}
+	for _, test := range tests {
+		tracker := newExecTracker()
+		for i, msg := range test.messages {
+			event, ok := tracker.parse(msg)
+			switch {
+			case test.exp[i] == nil && ok:
+				t.Errorf("%s: %s: unexpected event %+v", test.name, msg.Action, event)
+			case test.exp[i] != nil && !ok:
+				t.Errorf("%s: %s: expected event %+v", test.name, msg.Action, *test.exp[i])
+			case test.exp[i] != nil && !reflect.DeepEqual(event, *test.exp[i]):
+				t.Errorf("%s: %s: got %+v, expected %+v", test.name, msg.Action, event, *test.exp[i])
+			}
+		}
+		if len(tracker.commands) != 0 {
+			t.Errorf("%s: leaked exec commands: %v", test.name, tracker.commands)
+		}
+	}
+}
+
+func TestRunsCommand(t *testing.T) {
+	tests := []struct {
+		commandLine, name string
+		exp               bool
+	}{
+		{"migrate", "migrate", true},
+		{"/app/bin/migrate --up", "migrate", true},
+		{`sh -c "npm run migrate"`, "migrate", true},
+		{"sh -c 'migrate'", "migrate", true},
+		{"migrate-db", "migrate", false},
+		{"npm run seed", "migrate", false},
+		{"", "migrate", false},
+	}
+	for _, test := range tests {
+		if actual := runsCommand(test.commandLine, test.name); actual != test.exp {
+			t.Errorf("runsCommand(%q, %q) = %t, expected %t", test.commandLine, test.name, actual, test.exp)
+		}
+	}
+}
+
+func TestLabelRules(t *testing.T) {
+	type rule struct {
+		on, command string
+	}
+
+	tests := []struct {
+		label string
+		exp   []rule
+	}{
+		{"", nil},
+		{"stop", []rule{{on: triggerStop}}},
+		{"stop, healthy", []rule{{on: triggerStop}, {on: triggerHealthy}}},
+		{"exec:migrate,stop", []rule{{on: triggerExec, command: "migrate"}, {on: triggerStop}}},
+		{"start,,exec,exec:", nil},
+	}
+	for _, test := range tests {
+		attributes := map[string]string{"name": "db", snapshotOnLabel: test.label}
+
+		var actual []rule
+		for _, r := range labelRules(nil, attributes) {
+			actual = append(actual, rule{on: r.on, command: r.command})
+			if !r.containers["db"] || len(r.containers) != 1 {
+				t.Errorf("%q: rule applies to %v, expected db", test.label, r.containers)
+			}
+		}
+		if !reflect.DeepEqual(actual, test.exp) {
+			t.Errorf("%q: got %+v, expected %+v", test.label, actual, test.exp)
+		}
+	}
+}
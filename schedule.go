@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule decides when automatic snapshots are taken.
+type schedule interface {
+	// next returns the first time after the given time that the schedule
+	// fires.
+	next(after time.Time) time.Time
+}
+
+// intervalSchedule fires at a fixed interval.
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+
+// cronSchedule fires at the times matched by a standard five field cron
+// expression: minute, hour, day of month, month, and day of week.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek map[int]bool
+
+	// Like cron, if both the day of month and day of week are restricted, a
+	// day matches if either of them match. Fields starting with `*`, such
+	// as `*/2`, aren't considered restricted.
+	dayOfMonthRestricted, dayOfWeekRestricted bool
+}
+
+// cronFields are the names and bounds of the fields in a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// parseCron parses a cron expression. Each field is either `*`, a number, a
+// range such as `1-5`, or a comma separated list of them. Ranges and `*` can
+// be followed by a step, such as `*/15`.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expr, len(cronFields))
+	}
+
+	var sets []map[int]bool
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s in cron expression %q: %w", cronFields[i].name, expr, err)
+		}
+		sets = append(sets, set)
+	}
+
+	return &cronSchedule{
+		minute:               sets[0],
+		hour:                 sets[1],
+		dayOfMonth:           sets[2],
+		month:                sets[3],
+		dayOfWeek:            sets[4],
+		dayOfMonthRestricted: !strings.HasPrefix(fields[2], "*"),
+		dayOfWeekRestricted:  !strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i != -1 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("bad step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("bad range %q", part)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q", part)
+			}
+			start, end = value, value
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := start; value <= end; value += step {
+			set[value] = true
+		}
+	}
+	return set, nil
+}
+
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// Every valid expression matches at least once every few years, so stop
+	// searching eventually in case the expression can never match, such as
+	// on February 30th.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth[t.Day()]
+	dayOfWeek := s.dayOfWeek[int(t.Weekday())]
+	if s.dayOfMonthRestricted && s.dayOfWeekRestricted {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// parseSchedule parses either an interval, such as "1h", or a cron
+// expression.
+func parseSchedule(every, cron string) (schedule, error) {
+	switch {
+	case every != "" && cron != "":
+		return nil, errors.New("only one of an interval or a cron expression can be set")
+	case every != "":
+		interval, err := parseAge(every)
+		if err != nil {
+			return nil, err
+		}
+		if interval < time.Minute {
+			return nil, fmt.Errorf("interval %q must be at least a minute", every)
+		}
+		return intervalSchedule(interval), nil
+	case cron != "":
+		return parseCron(cron)
+	default:
+		return nil, errors.New("either an interval or a cron expression is required")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := []struct {
+		name, every, cron string
+	}{
+		{"neither", "", ""},
+		{"both", "1h", "* * * * *"},
+		{"malformed interval", "often", ""},
+		{"short interval", "30s", ""},
+		{"too few fields", "", "* * * *"},
+		{"too many fields", "", "* * * * * *"},
+		{"out of range", "", "60 * * * *"},
+		{"zero day of month", "", "0 0 0 * *"},
+		{"backwards range", "", "0 17-9 * * *"},
+		{"bad step", "", "*/0 * * * *"},
+		{"bad value", "", "0 noon * * *"},
+	}
+	for _, test := range tests {
+		if _, err := parseSchedule(test.every, test.cron); err == nil {
+			t.Errorf("%s: expected an error for every=%q cron=%q", test.name, test.every, test.cron)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name, every, cron string
+		after, exp        time.Time
+	}{
+		{
+			name:  "interval",
+			every: "90m",
+			after: date(2020, time.January, 1, 10, 7),
+			exp:   date(2020, time.January, 1, 11, 37),
+		},
+		{
+			name:  "interval in days",
+			every: "1d",
+			after: date(2020, time.January, 1, 10, 7),
+			exp:   date(2020, time.January, 2, 10, 7),
+		},
+		{
+			name:  "every minute skips the current minute",
+			cron:  "* * * * *",
+			after: date(2020, time.January, 1, 10, 7).Add(30 * time.Second),
+			exp:   date(2020, time.January, 1, 10, 8),
+		},
+		{
+			name:  "minute step",
+			cron:  "*/15 * * * *",
+			after: date(2020, time.January, 1, 10, 7),
+			exp:   date(2020, time.January, 1, 10, 15),
+		},
+		{
+			name:  "minute step wraps to the next hour",
+			cron:  "*/15 * * * *",
+			after: date(2020, time.January, 1, 10, 45),
+			exp:   date(2020, time.January, 1, 11, 0),
+		},
+		{
+			name:  "range with step",
+			cron:  "0 9-17/4 * * *",
+			after: date(2020, time.January, 1, 13, 0),
+			exp:   date(2020, time.January, 1, 17, 0),
+		},
+		{
+			name:  "list",
+			cron:  "0 0 1,15 * *",
+			after: date(2020, time.January, 2, 0, 0),
+			exp:   date(2020, time.January, 15, 0, 0),
+		},
+		{
+			name:  "weekdays skip the weekend",
+			cron:  "0 9 * * 1-5",
+			after: date(2020, time.January, 3, 10, 0), // Friday
+			exp:   date(2020, time.January, 6, 9, 0),  // Monday
+		},
+		{
+			name:  "sunday",
+			cron:  "0 0 * * 0",
+			after: date(2020, time.January, 4, 12, 0), // Saturday
+			exp:   date(2020, time.January, 5, 0, 0),
+		},
+		{
+			name:  "restricted day of month and day of week match either",
+			cron:  "0 0 13 * 5",
+			after: date(2020, time.March, 1, 0, 0),
+			exp:   date(2020, time.March, 6, 0, 0), // The first Friday.
+		},
+		{
+			name:  "day of month step doesn't restrict",
+			cron:  "0 0 */2 * 1",
+			after: date(2020, time.January, 1, 0, 0),
+			exp:   date(2020, time.January, 13, 0, 0), // The first Monday on an odd day.
+		},
+		{
+			name:  "day of week step doesn't restrict",
+			cron:  "0 0 15 * */2",
+			after: date(2020, time.January, 1, 0, 0),
+			exp:   date(2020, time.February, 15, 0, 0), // The first 15th on an even weekday.
+		},
+		{
+			name:  "month rollover",
+			cron:  "30 23 31 12 *",
+			after: date(2020, time.December, 31, 23, 30),
+			exp:   date(2021, time.December, 31, 23, 30),
+		},
+		{
+			name:  "leap day",
+			cron:  "0 0 29 2 *",
+			after: date(2021, time.January, 1, 0, 0),
+			exp:   date(2024, time.February, 29, 0, 0),
+		},
+		{
+			name:  "never matches",
+			cron:  "0 0 30 2 *",
+			after: date(2020, time.January, 1, 0, 0),
+			exp:   time.Time{},
+		},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.every, test.cron)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if next := s.next(test.after); !next.Equal(test.exp) {
+			t.Errorf("%s: next after %s is %s, expected %s", test.name, test.after, next, test.exp)
+		}
+	}
+}